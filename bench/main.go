@@ -138,7 +138,9 @@ func benchmark(n int) (int64, int64, int64, int64, int64, int) {
 		time.Sleep(time.Millisecond * 200)
 
 		startAppend := time.Now()
-		sk.AppendTagProof(&σ, r, msg, prefix)
+		if err := sk.AppendTagProof(pp, &σ, r, msg, prefix); err != nil {
+			panic(err)
+		}
 		totalAppendTagTime += time.Since(startAppend)
 
 		time.Sleep(time.Millisecond * 200)
@@ -8,14 +8,17 @@ package common
 
 import (
 	"bytes"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math/big"
 	"math/bits"
 
 	math "github.com/IBM/mathlib"
 	common2 "github.com/IBM/mathlib/driver/common"
+	"github.com/consensys/gnark-crypto/ecc/bn254"
 	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
 )
 
@@ -23,6 +26,11 @@ var (
 	c      = math.Curves[1]
 	lambda = c.FieldBytes
 	h      = c.HashToG1(sha256Digest("DualDory"))
+
+	G1Size = len(c.GenG1.Bytes())
+	G2Size = len(c.GenG2.Bytes())
+	GtSize = len(c.GenGt.Bytes())
+	ZrSize = lambda
 )
 
 type G1v []*math.G1
@@ -132,6 +140,11 @@ func (g2v G2v) Sum() *math.G2 {
 }
 
 func (g1v G1v) InnerProd(g2v G2v) *math.Gt {
+	return defaultExecutor.InnerProd(g1v, g2v)
+}
+
+// InnerProd computes the product of the pairings of all pairs of elements, see millerLoop.
+func (ex *Executor) InnerProd(g1v G1v, g2v G2v) *math.Gt {
 	if len(g1v) != len(g2v) {
 		panic(fmt.Sprintf("length mismatch"))
 	}
@@ -144,18 +157,123 @@ func (g1v G1v) InnerProd(g2v G2v) *math.Gt {
 		return e(g1v[0], g2v[0])
 	}
 
-	prod := c.Pairing(g2v[0], g1v[0])
+	return c.FExp(millerLoop(ex, g1v, g2v))
+}
 
-	for i := 1; i < len(g2v); i++ {
-		x := c.Pairing(g2v[i], g1v[i])
-		prod.Mul(x)
+// parallelPairingThreshold is the length of the vectors below which
+// InnerProd computes all of their Miller loops on the calling goroutine.
+const parallelPairingThreshold = 32
+
+// millerLoop returns the product of the Miller loops of all pairs of elements, without the final exponentiation.
+// Vectors of at least parallelPairingThreshold elements are split into a chunk per worker, and the Miller loops
+// of the chunks are computed in parallel by the executor.
+func millerLoop(ex *Executor, g1v G1v, g2v G2v) *math.Gt {
+	n := len(g1v)
+	if n < parallelPairingThreshold {
+		return sequentialMillerLoop(g1v, g2v)
+	}
+
+	// A chunk for every worker and one for the calling goroutine, but none smaller than half the threshold
+	w := ex.Workers()
+	size := (n + w) / (w + 1)
+	if size < parallelPairingThreshold/2 {
+		size = parallelPairingThreshold / 2
+	}
+
+	partial := make([]*math.Gt, (n+size-1)/size)
+	tasks := make([]func(), len(partial))
+	for i := range tasks {
+		i := i
+		tasks[i] = func() {
+			end := (i + 1) * size
+			if end > n {
+				end = n
+			}
+			partial[i] = sequentialMillerLoop(g1v[i*size:end], g2v[i*size:end])
+		}
+	}
+
+	ex.Parallel(tasks...)
+
+	for _, x := range partial[1:] {
+		partial[0].Mul(x)
 	}
 
-	prod = c.FExp(prod)
+	return partial[0]
+}
+
+// sequentialMillerLoop is millerLoop on the calling goroutine.
+// It computes the Miller loops of two pairs at a time, which share their squarings.
+func sequentialMillerLoop(g1v G1v, g2v G2v) *math.Gt {
+	var prod *math.Gt
+	i := 0
+
+	if len(g1v)%2 == 1 {
+		prod = c.Pairing(g2v[0], g1v[0])
+		i = 1
+	}
+
+	for ; i < len(g1v); i += 2 {
+		x := c.Pairing2(g2v[i], g1v[i], g2v[i+1], g1v[i+1])
+		if prod == nil {
+			prod = x
+		} else {
+			prod.Mul(x)
+		}
+	}
 
 	return prod
 }
 
+// MultiExpGt computes the product of bases[i]^exponents[i] with 4 bit windows,
+// sharing the squarings among all exponents.
+// The bases are expected to be in the cyclotomic subgroup, as any pairing output is.
+func MultiExpGt(bases []*math.Gt, exponents []*math.Zr) *math.Gt {
+	if len(bases) != len(exponents) {
+		panic(fmt.Sprintf("length mismatch"))
+	}
+
+	tables := make([][16]bn254.GT, len(bases))
+	digits := make([][]byte, len(bases))
+
+	for i, base := range bases {
+		tables[i][0].SetOne()
+		if err := tables[i][1].SetBytes(base.Bytes()); err != nil {
+			panic(err)
+		}
+		for j := 2; j < 16; j++ {
+			tables[i][j].Mul(&tables[i][j-1], &tables[i][1])
+		}
+
+		digits[i] = new(big.Int).SetBytes(exponents[i].Bytes()).FillBytes(make([]byte, ZrSize))
+	}
+
+	var res bn254.GT
+	res.SetOne()
+
+	for j := 0; j < 2*ZrSize; j++ {
+		for k := 0; k < 4; k++ {
+			res.CyclotomicSquare(&res)
+		}
+		for i := range tables {
+			digit := digits[i][j/2]
+			if j%2 == 0 {
+				digit >>= 4
+			}
+			if digit &= 0xf; digit != 0 {
+				res.Mul(&res, &tables[i][digit])
+			}
+		}
+	}
+
+	encoded := res.Bytes()
+	gt, err := c.NewGtFromBytes(encoded[:])
+	if err != nil {
+		panic(err)
+	}
+	return gt
+}
+
 func e(g1 *math.G1, g2 *math.G2) *math.Gt {
 	gt := c.Pairing(g2, g1)
 	return c.FExp(gt)
@@ -179,6 +297,183 @@ func FieldElementFromBytes(digest []byte) *math.Zr {
 	return c.NewZrFromBytes(common2.BigToBytes(n))
 }
 
+// RandomZr returns a uniformly random scalar read from rnd, or an error if rnd cannot provide enough randomness.
+// Unlike NewRandomZr of the curve, which ignores the reader it is given, all of its randomness comes from rnd.
+func RandomZr(rnd io.Reader) (*math.Zr, error) {
+	buff := make([]byte, 64)
+	if _, err := io.ReadFull(rnd, buff); err != nil {
+		return nil, fmt.Errorf("failed reading randomness: %v", err)
+	}
+	n := new(big.Int).SetBytes(buff)
+	n.Mod(n, fr.Modulus())
+	return c.NewZrFromBytes(common2.BigToBytes(n)), nil
+}
+
+// MustRandomZr is RandomZr, but panics if rnd cannot provide enough randomness.
+func MustRandomZr(rnd io.Reader) *math.Zr {
+	x, err := RandomZr(rnd)
+	if err != nil {
+		panic(err)
+	}
+	return x
+}
+
+// RandomWeight returns a random 128 bit scalar, which suffices for batch verification.
+func RandomWeight() *math.Zr {
+	buff := make([]byte, 16)
+	if _, err := rand.Read(buff); err != nil {
+		panic(err)
+	}
+	return c.NewZrFromBytes(buff)
+}
+
+// G1FromBytes parses a G1 element, ensuring it is on the curve and in the prime order subgroup,
+// and that the encoding is canonical.
+func G1FromBytes(b []byte) (*math.G1, error) {
+	if len(b) != G1Size {
+		return nil, fmt.Errorf("G1 element should be %d bytes but is %d bytes", G1Size, len(b))
+	}
+	g, err := c.NewG1FromBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid G1 element: %v", err)
+	}
+	if !bytes.Equal(g.Bytes(), b) {
+		return nil, fmt.Errorf("non canonical G1 encoding")
+	}
+	return g, nil
+}
+
+// G2FromBytes parses a G2 element, ensuring it is on the curve and in the prime order subgroup,
+// and that the encoding is canonical.
+func G2FromBytes(b []byte) (*math.G2, error) {
+	if len(b) != G2Size {
+		return nil, fmt.Errorf("G2 element should be %d bytes but is %d bytes", G2Size, len(b))
+	}
+	g, err := c.NewG2FromBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid G2 element: %v", err)
+	}
+	if !bytes.Equal(g.Bytes(), b) {
+		return nil, fmt.Errorf("non canonical G2 encoding")
+	}
+	return g, nil
+}
+
+// GtFromBytes parses a Gt element, ensuring it is in the order r subgroup of the cyclotomic subgroup,
+// and that the encoding is canonical.
+func GtFromBytes(b []byte) (*math.Gt, error) {
+	if len(b) != GtSize {
+		return nil, fmt.Errorf("Gt element should be %d bytes but is %d bytes", GtSize, len(b))
+	}
+
+	var z bn254.GT
+	if err := z.SetBytes(b); err != nil {
+		return nil, fmt.Errorf("invalid Gt element: %v", err)
+	}
+
+	encoded := z.Bytes()
+	if !bytes.Equal(encoded[:], b) {
+		return nil, fmt.Errorf("non canonical Gt encoding")
+	}
+
+	// z is in the cyclotomic subgroup iff z^(p^6+1) = 1 and z^(p^4-p^2+1) = 1
+	var conj, frob2, frob4, one bn254.GT
+	one.SetOne()
+	conj.Conjugate(&z)
+	conj.Mul(&conj, &z)
+	frob2.FrobeniusSquare(&z)
+	frob4.FrobeniusSquare(&frob2)
+	frob4.Mul(&frob4, &z)
+	if !conj.Equal(&one) || !frob4.Equal(&frob2) || !z.IsInSubGroup() {
+		return nil, fmt.Errorf("Gt element not in subgroup")
+	}
+
+	gt, err := c.NewGtFromBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Gt element: %v", err)
+	}
+	return gt, nil
+}
+
+// CheckG1 checks that g is present and in the prime order subgroup, as if it was parsed with G1FromBytes.
+func CheckG1(g *math.G1) error {
+	if g == nil {
+		return fmt.Errorf("missing G1 element")
+	}
+	_, err := G1FromBytes(g.Bytes())
+	return err
+}
+
+// CheckG2 checks that g is present and in the prime order subgroup, as if it was parsed with G2FromBytes.
+func CheckG2(g *math.G2) error {
+	if g == nil {
+		return fmt.Errorf("missing G2 element")
+	}
+	_, err := G2FromBytes(g.Bytes())
+	return err
+}
+
+// CheckGt checks that g is present and in the order r subgroup, as if it was parsed with GtFromBytes.
+func CheckGt(g *math.Gt) error {
+	if g == nil {
+		return fmt.Errorf("missing Gt element")
+	}
+	_, err := GtFromBytes(g.Bytes())
+	return err
+}
+
+// CheckZr checks that x is present and reduced modulo the group order, as if it was parsed with ZrFromBytes.
+func CheckZr(x *math.Zr) error {
+	if x == nil {
+		return fmt.Errorf("missing scalar")
+	}
+	_, err := ZrFromBytes(x.Bytes())
+	return err
+}
+
+// ZrFromBytes parses a scalar, ensuring it is reduced modulo the group order.
+func ZrFromBytes(b []byte) (*math.Zr, error) {
+	if len(b) != ZrSize {
+		return nil, fmt.Errorf("scalar should be %d bytes but is %d bytes", ZrSize, len(b))
+	}
+	if new(big.Int).SetBytes(b).Cmp(fr.Modulus()) >= 0 {
+		return nil, fmt.Errorf("scalar not reduced modulo group order")
+	}
+	return c.NewZrFromBytes(b), nil
+}
+
+// G1vFromBytes parses a concatenation of G1 elements as produced by G1v.Bytes().
+func G1vFromBytes(b []byte) (G1v, error) {
+	if len(b)%G1Size != 0 {
+		return nil, fmt.Errorf("G1 vector length %d is not a multiple of %d", len(b), G1Size)
+	}
+	res := make(G1v, len(b)/G1Size)
+	for i := 0; i < len(res); i++ {
+		g, err := G1FromBytes(b[i*G1Size : (i+1)*G1Size])
+		if err != nil {
+			return nil, err
+		}
+		res[i] = g
+	}
+	return res, nil
+}
+
+// G2vFromBytes parses a concatenation of G2 elements as produced by G2v.Bytes().
+func G2vFromBytes(b []byte) (G2v, error) {
+	if len(b)%G2Size != 0 {
+		return nil, fmt.Errorf("G2 vector length %d is not a multiple of %d", len(b), G2Size)
+	}
+	res := make(G2v, len(b)/G2Size)
+	for i := 0; i < len(res); i++ {
+		g, err := G2FromBytes(b[i*G2Size : (i+1)*G2Size])
+		if err != nil {
+			return nil, err
+		}
+		res[i] = g
+	}
+	return res, nil
+}
+
 func feFrom256Bits(bytes []byte) *fr.Element {
 	if len(bytes) != 32 {
 		panic(fmt.Sprintf("input should be 32 bytes"))
@@ -0,0 +1,58 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"crypto/rand"
+	"testing"
+
+	math "github.com/IBM/mathlib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiExpGt(t *testing.T) {
+	var bases []*math.Gt
+	var exponents []*math.Zr
+
+	expected := e(c.GenG1, c.GenG2).Exp(c.NewZrFromInt(0))
+
+	for i := 0; i < 5; i++ {
+		base := e(c.GenG1.Mul(c.NewRandomZr(rand.Reader)), c.GenG2)
+		exponent := c.NewRandomZr(rand.Reader)
+		bases = append(bases, base)
+		exponents = append(exponents, exponent)
+		expected.Mul(base.Exp(exponent))
+	}
+
+	bases = append(bases, bases[0])
+	exponents = append(exponents, c.NewZrFromInt(0))
+
+	assert.True(t, expected.Equals(MultiExpGt(bases, exponents)))
+	assert.True(t, MultiExpGt(nil, nil).IsUnity())
+}
+
+func TestInnerProd(t *testing.T) {
+	ex, sequential := NewExecutor(3), NewExecutor(0)
+
+	var g1v G1v
+	var g2v G2v
+	for i := 0; i < 2*parallelPairingThreshold+3; i++ {
+		g1v = append(g1v, c.GenG1.Mul(c.NewRandomZr(rand.Reader)))
+		g2v = append(g2v, c.GenG2.Mul(c.NewRandomZr(rand.Reader)))
+	}
+
+	for _, n := range []int{1, 2, 3, parallelPairingThreshold - 1, parallelPairingThreshold, len(g1v)} {
+		expected := e(g1v[0], g2v[0])
+		for i := 1; i < n; i++ {
+			expected.Mul(e(g1v[i], g2v[i]))
+		}
+
+		assert.True(t, expected.Equals(g1v[:n].InnerProd(g2v[:n])), "length %d", n)
+		assert.True(t, expected.Equals(ex.InnerProd(g1v[:n], g2v[:n])), "length %d with 3 workers", n)
+		assert.True(t, expected.Equals(sequential.InnerProd(g1v[:n], g2v[:n])), "length %d without workers", n)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// NonceReader is an HMAC-DRBG with SHA256, in the style of RFC 6979.
+// It is seeded by a secret and a context, hence the nonces it outputs are deterministic,
+// unless fresh randomness is included in the context, in which case they are hedged:
+// they remain unpredictable as long as either the secret or the fresh randomness is.
+type NonceReader struct {
+	k, v []byte
+}
+
+// NewNonceReader seeds a NonceReader with the secret and every element of the context.
+// The elements are framed with their length, hence distinct contexts never result in the same seed.
+func NewNonceReader(secret []byte, context ...[]byte) *NonceReader {
+	seed := frame(secret)
+	for _, c := range context {
+		seed = append(seed, frame(c)...)
+	}
+
+	return newHMACDRBG(seed)
+}
+
+// newHMACDRBG instantiates an HMAC-DRBG with SHA256 from the seed material, as in NIST SP 800-90A.
+func newHMACDRBG(seed []byte) *NonceReader {
+	nr := &NonceReader{
+		k: make([]byte, sha256.Size),
+		v: make([]byte, sha256.Size),
+	}
+	for i := range nr.v {
+		nr.v[i] = 0x01
+	}
+
+	nr.update(seed)
+	return nr
+}
+
+func (nr *NonceReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		nr.v = nr.mac(nr.v)
+		n += copy(p[n:], nr.v)
+	}
+
+	nr.update(nil)
+	return n, nil
+}
+
+// update is the HMAC-DRBG update function.
+func (nr *NonceReader) update(data []byte) {
+	nr.k = nr.mac(nr.v, []byte{0x00}, data)
+	nr.v = nr.mac(nr.v)
+	if len(data) == 0 {
+		return
+	}
+	nr.k = nr.mac(nr.v, []byte{0x01}, data)
+	nr.v = nr.mac(nr.v)
+}
+
+func (nr *NonceReader) mac(data ...[]byte) []byte {
+	h := hmac.New(sha256.New, nr.k)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func frame(data []byte) []byte {
+	res := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(res, uint64(len(data)))
+	return append(res, data...)
+}
@@ -0,0 +1,63 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNonceReader(t *testing.T) {
+	for _, vector := range []struct {
+		context  [][]byte
+		expected []string
+	}{
+		{
+			context: [][]byte{[]byte("context")},
+			expected: []string{
+				"2905298e17128fe284d3d76d4978b09ec93355969c31c2dc11f07fc3045bb00700e0391cf2c76c19a89c182693c31cf9fbab6b1cf0b46a5fd6aa9359c9658e3c",
+				"28679b91592b34bc19f804b27e67626dbc5d656e1e8546719515d3cd5d30b08bf3344691ff84610e5b7e9c6e7d7d786402bbaf34a98251a0aaa41d05bbba84b0",
+			},
+		},
+		{
+			context: [][]byte{[]byte("context"), nil},
+			expected: []string{
+				"24cd0e94e92ee10fdf4d667f65b762feaaa2821e28c8f4b2ced2bcd00cbb443d6f2ff1531f15842415acbb1e4583e3f2cbb44767d762471e961df2eff9df6052",
+			},
+		},
+		{
+			context: [][]byte{[]byte("contex"), []byte("t")},
+			expected: []string{
+				"d294e3678362293a8db28474b219d922a1b472019b2d91e87f3d2503e6f9653470309620e5484fe6337e4d0b9684dfade81f8931e405cf8b835e5af799c1dc6f",
+			},
+		},
+	} {
+		nr := NewNonceReader([]byte("secret"), vector.context...)
+		for _, expected := range vector.expected {
+			buff := make([]byte, 64)
+			n, err := nr.Read(buff)
+			assert.NoError(t, err)
+			assert.Equal(t, 64, n)
+			assert.Equal(t, expected, hex.EncodeToString(buff))
+		}
+	}
+}
+
+// TestHMACDRBG cross-checks the HMAC-DRBG against the nonce of RFC 6979, A.2.5, for P-256 with SHA-256 and message "sample",
+// which is the first output of the HMAC-DRBG seeded with the private key and the hash of the message.
+func TestHMACDRBG(t *testing.T) {
+	x, _ := hex.DecodeString("c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721")
+	h := sha256.Sum256([]byte("sample"))
+
+	buff := make([]byte, 32)
+	_, err := newHMACDRBG(append(x, h[:]...)).Read(buff)
+	assert.NoError(t, err)
+	assert.Equal(t, "a6e3c57dd01abe90086538398355dd4c3b17aa873382b0f24d6129493d8aad60", hex.EncodeToString(buff))
+}
@@ -0,0 +1,93 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	math "github.com/IBM/mathlib"
+)
+
+// Protocol labels that domain separate the transcripts of the different protocols.
+const (
+	DoryLabel               = "DualDory/Dory"
+	HidingDoryLabel         = "DualDory/HidingDory"
+	TagProofLabel           = "DualDory/TagProof"
+	TraceLabel              = "DualDory/Trace"
+	RingSignatureLabel      = "DualDory/RingSignature"
+	ThresholdSignatureLabel = "DualDory/ThresholdSignature"
+	OpeningLabel            = "DualDory/Opening"
+)
+
+// Transcript is a Fiat-Shamir transcript.
+// Every element appended to it is framed with its label and its length,
+// hence distinct sequences of appended elements never result in the same state.
+type Transcript struct {
+	state []byte
+}
+
+func NewTranscript(label string) *Transcript {
+	t := &Transcript{}
+	t.absorb("protocol", []byte(label))
+	return t
+}
+
+// Fork returns a copy of the transcript that continues independently under the given label.
+func (t *Transcript) Fork(label string) *Transcript {
+	fork := &Transcript{
+		state: append([]byte(nil), t.state...),
+	}
+	fork.absorb("fork", []byte(label))
+	return fork
+}
+
+// Digest returns the current state of the transcript.
+func (t *Transcript) Digest() []byte {
+	return append([]byte(nil), t.state...)
+}
+
+func (t *Transcript) AppendBytes(label string, b []byte) {
+	t.absorb(label, b)
+}
+
+func (t *Transcript) AppendG1(label string, g *math.G1) {
+	t.absorb(label, g.Bytes())
+}
+
+func (t *Transcript) AppendG2(label string, g *math.G2) {
+	t.absorb(label, g.Bytes())
+}
+
+func (t *Transcript) AppendGt(label string, g *math.Gt) {
+	t.absorb(label, g.Bytes())
+}
+
+func (t *Transcript) AppendZr(label string, z *math.Zr) {
+	t.absorb(label, z.Bytes())
+}
+
+// ChallengeZr derives a challenge from everything appended to the transcript so far,
+// and appends the challenge label to the transcript.
+func (t *Transcript) ChallengeZr(label string) *math.Zr {
+	t.absorb("challenge", []byte(label))
+	return FieldElementFromBytes(t.state)
+}
+
+func (t *Transcript) absorb(label string, data []byte) {
+	var length [8]byte
+
+	h := sha256.New()
+	h.Write(t.state)
+	binary.BigEndian.PutUint64(length[:], uint64(len(label)))
+	h.Write(length[:])
+	h.Write([]byte(label))
+	binary.BigEndian.PutUint64(length[:], uint64(len(data)))
+	h.Write(length[:])
+	h.Write(data)
+	t.state = h.Sum(nil)
+}
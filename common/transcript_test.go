@@ -0,0 +1,40 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscript(t *testing.T) {
+	challenge := func(appends ...[2]string) []byte {
+		tr := NewTranscript("test")
+		for _, a := range appends {
+			tr.AppendBytes(a[0], []byte(a[1]))
+		}
+		return tr.ChallengeZr("c").Bytes()
+	}
+
+	assert.Equal(t, challenge([2]string{"a", "b"}), challenge([2]string{"a", "b"}))
+	// Labels and lengths are framed, so shifting bytes between them changes the challenge
+	assert.NotEqual(t, challenge([2]string{"a", "bc"}), challenge([2]string{"ab", "c"}))
+	assert.NotEqual(t, challenge([2]string{"a", "bc"}), challenge([2]string{"a", "b"}, [2]string{"", "c"}))
+
+	tr1, tr2 := NewTranscript("test"), NewTranscript("other")
+	assert.NotEqual(t, tr1.ChallengeZr("c").Bytes(), tr2.ChallengeZr("c").Bytes())
+
+	tr := NewTranscript("test")
+	fork1, fork2 := tr.Fork("1"), tr.Fork("2")
+	assert.NotEqual(t, fork1.Digest(), fork2.Digest())
+	assert.Equal(t, fork1.Digest(), tr.Fork("1").Digest())
+
+	c1 := tr.ChallengeZr("c")
+	c2 := tr.ChallengeZr("c")
+	assert.False(t, c1.Equals(c2))
+}
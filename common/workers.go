@@ -0,0 +1,81 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"runtime"
+	"sync"
+)
+
+// An Executor bounds the number of goroutines that run tasks for Parallel.
+// It is passed along with the public parameters, see dory.WithExecutor, and is shared by everything
+// that runs with them, including signing, verification and Dory proofs.
+// A nil Executor runs tasks on a default one, bounded to the number of CPUs.
+type Executor struct {
+	workers int
+	slots   chan struct{}
+}
+
+var defaultExecutor = NewExecutor(runtime.NumCPU())
+
+// NewExecutor returns an Executor that runs tasks on at most n goroutines,
+// in addition to the goroutines that call it.
+// With n = 0, tasks run sequentially on the calling goroutine.
+func NewExecutor(n int) *Executor {
+	if n < 0 {
+		panic("negative number of workers")
+	}
+
+	return &Executor{
+		workers: n,
+		slots:   make(chan struct{}, n),
+	}
+}
+
+func (ex *Executor) orDefault() *Executor {
+	if ex == nil {
+		return defaultExecutor
+	}
+	return ex
+}
+
+// Workers returns the bound on the number of workers.
+func (ex *Executor) Workers() int {
+	return ex.orDefault().workers
+}
+
+// Parallel runs the tasks concurrently and returns once all of them are done.
+// A task that finds no idle worker runs on the calling goroutine instead,
+// hence tasks may call Parallel themselves without exhausting the workers.
+func (ex *Executor) Parallel(tasks ...func()) {
+	ex = ex.orDefault()
+
+	var wg sync.WaitGroup
+
+	for i, task := range tasks {
+		if i == len(tasks)-1 {
+			task()
+			break
+		}
+
+		select {
+		case ex.slots <- struct{}{}:
+			wg.Add(1)
+			go func(task func()) {
+				defer func() {
+					<-ex.slots
+					wg.Done()
+				}()
+				task()
+			}(task)
+		default:
+			task()
+		}
+	}
+
+	wg.Wait()
+}
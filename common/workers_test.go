@@ -0,0 +1,59 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package common
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallel(t *testing.T) {
+	ex := NewExecutor(2)
+
+	var running, maxRunning, done int32
+
+	task := func() {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		runtime.Gosched()
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&done, 1)
+	}
+
+	// Tasks that run nested tasks do not deadlock once all workers are busy
+	var tasks []func()
+	for i := 0; i < 100; i++ {
+		tasks = append(tasks, func() {
+			ex.Parallel(task, task, task)
+		})
+	}
+
+	ex.Parallel(tasks...)
+
+	assert.Equal(t, int32(300), done)
+	// Two workers, and the calling goroutine
+	assert.LessOrEqual(t, maxRunning, int32(3))
+
+	assert.Equal(t, 2, ex.Workers())
+	assert.Equal(t, runtime.NumCPU(), (*Executor)(nil).Workers())
+
+	var order []int
+	NewExecutor(0).Parallel(func() { order = append(order, 0) }, func() { order = append(order, 1) })
+	assert.Equal(t, []int{0, 1}, order)
+
+	assert.Panics(t, func() {
+		NewExecutor(-1)
+	})
+}
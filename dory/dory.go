@@ -7,11 +7,15 @@ SPDX-License-Identifier: Apache-2.0
 package dory
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/asn1"
+	"errors"
 	"fmt"
+	"io"
 	. "privacy-perserving-audit/common"
+	"sync"
 
 	math "github.com/IBM/mathlib"
 	"github.com/consensys/gnark-crypto/ecc/bn254"
@@ -29,10 +33,17 @@ type Proof struct {
 	digest                     []byte
 }
 
+// RawProof is the wire format of a Proof. It only contains what the prover sends,
+// everything else is recomputed by the verifier from the public parameters and the commitment.
 type RawProof struct {
-	Step1Elements              [][][]byte
-	Step2Elements              [][][]byte
-	ScalarProductProofElements []byte
+	Rounds []RawRound
+	E1, E2 []byte
+}
+
+// RawRound holds the prover messages of a single reduce round.
+type RawRound struct {
+	D1L, D1R, D2L, D2R []byte
+	Cplus, Cminus      []byte
 }
 
 func (p Proof) Digest() []byte {
@@ -44,16 +55,24 @@ func (p Proof) Digest() []byte {
 }
 
 func (p Proof) Bytes() []byte {
-	rp := RawProof{
-		ScalarProductProofElements: p.ScalarProductProofElements.Bytes(),
+	if len(p.Step1Elements) != len(p.Step2Elements) {
+		panic(fmt.Sprintf("malformed proof: %d step 1 rounds but %d step 2 rounds", len(p.Step1Elements), len(p.Step2Elements)))
 	}
 
-	for _, e := range p.Step1Elements {
-		rp.Step1Elements = append(rp.Step1Elements, e.Bytes())
+	rp := RawProof{
+		E1: p.ScalarProductProofElements.E1.Bytes(),
+		E2: p.ScalarProductProofElements.E2.Bytes(),
 	}
 
-	for _, e := range p.Step2Elements {
-		rp.Step2Elements = append(rp.Step2Elements, e.Bytes())
+	for i := range p.Step1Elements {
+		rp.Rounds = append(rp.Rounds, RawRound{
+			D1L:    p.Step1Elements[i].D1L.Bytes(),
+			D1R:    p.Step1Elements[i].D1R.Bytes(),
+			D2L:    p.Step1Elements[i].D2L.Bytes(),
+			D2R:    p.Step1Elements[i].D2R.Bytes(),
+			Cplus:  p.Step2Elements[i].Cplus.Bytes(),
+			Cminus: p.Step2Elements[i].Cminus.Bytes(),
+		})
 	}
 
 	bytes, err := asn1.Marshal(rp)
@@ -64,6 +83,123 @@ func (p Proof) Bytes() []byte {
 
 }
 
+func ProofFromBytes(bytes []byte) (Proof, error) {
+	var rp RawProof
+	rest, err := asn1.Unmarshal(bytes, &rp)
+	if err != nil {
+		return Proof{}, fmt.Errorf("failed unmarshaling Dory proof: %v", err)
+	}
+	if len(rest) > 0 {
+		return Proof{}, fmt.Errorf("trailing bytes after Dory proof")
+	}
+
+	var p Proof
+
+	for i, round := range rp.Rounds {
+		var gts [6]*math.Gt
+		for j, b := range [][]byte{round.D1L, round.D1R, round.D2L, round.D2R, round.Cplus, round.Cminus} {
+			gts[j], err = GtFromBytes(b)
+			if err != nil {
+				return Proof{}, fmt.Errorf("round %d: element %d: %v", i, j, err)
+			}
+		}
+
+		p.Step1Elements = append(p.Step1Elements, ReduceProverStep1Elements{
+			D1L: gts[0],
+			D1R: gts[1],
+			D2L: gts[2],
+			D2R: gts[3],
+		})
+
+		p.Step2Elements = append(p.Step2Elements, ReduceProverStep2Elements{
+			Cplus:  gts[4],
+			Cminus: gts[5],
+		})
+	}
+
+	if p.ScalarProductProofElements.E1, err = G1vFromBytes(rp.E1); err != nil {
+		return Proof{}, fmt.Errorf("invalid E1: %v", err)
+	}
+
+	if p.ScalarProductProofElements.E2, err = G2vFromBytes(rp.E2); err != nil {
+		return Proof{}, fmt.Errorf("invalid E2: %v", err)
+	}
+
+	return p, nil
+}
+
+// HidingProof is a proof produced by ReduceHiding.
+type HidingProof struct {
+	Proof
+	HidingElements
+}
+
+// RawHidingProof is the wire format of a HidingProof.
+type RawHidingProof struct {
+	Proof        []byte
+	P1, P2, Q, R []byte
+	R1, R2, R3   []byte
+}
+
+func (p HidingProof) Digest() []byte {
+	return sha256Digest([][]byte{p.Bytes()})
+}
+
+func (p HidingProof) Bytes() []byte {
+	bytes, err := asn1.Marshal(RawHidingProof{
+		Proof: p.Proof.Bytes(),
+		P1:    p.P1.Bytes(),
+		P2:    p.P2.Bytes(),
+		Q:     p.Q.Bytes(),
+		R:     p.R.Bytes(),
+		R1:    p.R1.Bytes(),
+		R2:    p.R2.Bytes(),
+		R3:    p.R3.Bytes(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return bytes
+}
+
+func HidingProofFromBytes(serialized []byte) (HidingProof, error) {
+	var rp RawHidingProof
+	rest, err := asn1.Unmarshal(serialized, &rp)
+	if err != nil {
+		return HidingProof{}, fmt.Errorf("failed unmarshaling hiding Dory proof: %v", err)
+	}
+	if len(rest) > 0 {
+		return HidingProof{}, fmt.Errorf("trailing bytes after hiding Dory proof")
+	}
+
+	var p HidingProof
+	if p.Proof, err = ProofFromBytes(rp.Proof); err != nil {
+		return HidingProof{}, err
+	}
+
+	for _, gt := range []struct {
+		name string
+		dst  **math.Gt
+		src  []byte
+	}{{"P1", &p.P1, rp.P1}, {"P2", &p.P2, rp.P2}, {"Q", &p.Q, rp.Q}, {"R", &p.R, rp.R}} {
+		if *gt.dst, err = GtFromBytes(gt.src); err != nil {
+			return HidingProof{}, fmt.Errorf("invalid %s: %v", gt.name, err)
+		}
+	}
+
+	for _, zr := range []struct {
+		name string
+		dst  **math.Zr
+		src  []byte
+	}{{"R1", &p.R1, rp.R1}, {"R2", &p.R2, rp.R2}, {"R3", &p.R3, rp.R3}} {
+		if *zr.dst, err = ZrFromBytes(zr.src); err != nil {
+			return HidingProof{}, fmt.Errorf("invalid %s: %v", zr.name, err)
+		}
+	}
+
+	return p, nil
+}
+
 type Witness struct {
 	V1 G1v
 	V2 G2v
@@ -73,20 +209,103 @@ type Commitment struct {
 	C, D1, D2 *math.Gt
 }
 
+// pad extends the witness vectors with identity elements up to size n.
+// Padding does not change any of the inner products, hence vectors of arbitrary length
+// can be committed to and reduced with public parameters of the next power of two.
+func (w Witness) pad(n int) Witness {
+	if len(w.V1) > n || len(w.V2) > n {
+		panic(fmt.Sprintf("witness of size %d, %d exceeds public parameters of size %d", len(w.V1), len(w.V2), n))
+	}
+
+	padded := Witness{
+		V1: make(G1v, n),
+		V2: make(G2v, n),
+	}
+
+	copy(padded.V1, w.V1)
+	copy(padded.V2, w.V2)
+
+	for i := len(w.V1); i < n; i++ {
+		padded.V1[i] = c.NewG1()
+	}
+
+	for i := len(w.V2); i < n; i++ {
+		padded.V2[i] = c.NewG2()
+	}
+
+	return padded
+}
+
 func Commit(v1 G1v, v2 G2v, pp PP) (Commitment, Witness) {
+	w := Witness{
+		V1: v1,
+		V2: v2,
+	}.pad(len(pp.Γ1))
+
 	// Prepare non-blinding part
-	D1 := v1.InnerProd(pp.Γ2)
-	D2 := pp.Γ1.InnerProd(v2)
-	C := v1.InnerProd(v2)
+	D1 := pp.executor.InnerProd(w.V1, pp.Γ2)
+	D2 := pp.executor.InnerProd(pp.Γ1, w.V2)
+	C := pp.executor.InnerProd(w.V1, w.V2)
 
 	return Commitment{
-			D1: D1,
-			D2: D2,
-			C:  C,
-		}, Witness{
-			V1: v1,
-			V2: v2,
-		}
+		D1: D1,
+		D2: D2,
+		C:  C,
+	}, w
+}
+
+// Blinders are the exponents of the blinding generator in a hiding commitment.
+type Blinders struct {
+	C, D1, D2 *math.Zr
+}
+
+// HidingWitness is the witness of a hiding commitment.
+type HidingWitness struct {
+	Witness
+	Blinders
+}
+
+// CommitHiding commits to v1 and v2 like Commit does, but blinds C, D1 and D2
+// with random powers of the blinding generator, so the commitment reveals nothing about v1 and v2.
+func CommitHiding(v1 G1v, v2 G2v, pp PP) (Commitment, HidingWitness) {
+	return CommitHidingWithRand(rand.Reader, v1, v2, pp)
+}
+
+// CommitHidingWithRand is CommitHiding with the blinders read from rnd.
+func CommitHidingWithRand(rnd io.Reader, v1 G1v, v2 G2v, pp PP) (Commitment, HidingWitness) {
+	cmt, w := Commit(v1, v2, pp)
+
+	b := Blinders{
+		C:  MustRandomZr(rnd),
+		D1: MustRandomZr(rnd),
+		D2: MustRandomZr(rnd),
+	}
+
+	ht := blindingGenerator()
+
+	return Commitment{
+		C:  mulGt(cmt.C, ht.Exp(b.C)),
+		D1: mulGt(cmt.D1, ht.Exp(b.D1)),
+		D2: mulGt(cmt.D2, ht.Exp(b.D2)),
+	}, HidingWitness{
+		Witness:  w,
+		Blinders: b,
+	}
+}
+
+var (
+	ht     *math.Gt
+	htOnce sync.Once
+)
+
+// blindingGenerator returns the generator of Gt used for blinding,
+// which is the pairing of points hashed to G1 and G2, hence its discrete logarithm is unknown.
+func blindingGenerator() *math.Gt {
+	htOnce.Do(func() {
+		seed := sha256Digest([][]byte{[]byte("Dory blinding generator")})
+		ht = e(c.HashToG1(seed), hashToG2(seed))
+	})
+	return ht
 }
 
 type PP struct {
@@ -95,6 +314,24 @@ type PP struct {
 	Γ1 G1v
 	Γ2 G2v
 	χ  *math.Gt
+	// executor runs the pairings of commitments and proofs made and verified with the public parameters
+	executor *Executor
+}
+
+// WithExecutor returns a copy of the public parameters whose commitments and proofs are made
+// and verified on the given executor.
+func WithExecutor(pps []PP, executor *Executor) []PP {
+	res := make([]PP, len(pps))
+	for i, pp := range pps {
+		pp.executor = executor
+		res[i] = pp
+	}
+	return res
+}
+
+// Executor returns the executor of the public parameters, which is nil for the default one.
+func (pp PP) Executor() *Executor {
+	return pp.executor
 }
 
 type ReducePP struct {
@@ -141,24 +378,98 @@ func (sppe ScalarProductProofElements) Bytes() []byte {
 	return bytes
 }
 
+// challenge appends E1, E2 to the transcript and derives the challenge d of the scalar product proof.
+func (sppe ScalarProductProofElements) challenge(t *Transcript) *math.Zr {
+	t.AppendBytes("E1", sppe.E1.Bytes())
+	t.AppendBytes("E2", sppe.E2.Bytes())
+	return t.ChallengeZr("d")
+}
+
+// Verify verifies a scalar product proof that is not preceded by any reduce round.
 func (sppe ScalarProductProofElements) Verify(cmt Commitment) error {
-	C, D1, D2 := cmt.C, cmt.D1, cmt.D2
-	d := randomFE()
-	dInv := inverse(d)
+	if sppe.PP == nil {
+		return fmt.Errorf("scalar product proof has no public parameters")
+	}
+	if err := checkProof([]PP{*sppe.PP}, cmt, Proof{ScalarProductProofElements: sppe}); err != nil {
+		return err
+	}
+	t := NewTranscript(DoryLabel)
+	appendStatement(t, *sppe.PP, cmt)
+	return verifyReduce(t, []PP{*sppe.PP}, cmt, nil, nil, sppe, nil).Verify()
+}
 
-	leftEq := e(addG1(sppe.E1[0], sppe.PP.Γ1[0].Mul(d)),
-		addG2(sppe.E2[0], sppe.PP.Γ2[0].Mul(inverse(d))))
+// FinalCheck is the pairing equation e(P, Q) = T that a proof reduces to once all of its rounds are folded.
+type FinalCheck struct {
+	P *math.G1
+	Q *math.G2
+	T *math.Gt
+	// err is set if the proof is malformed, in which case there is no equation to check
+	err      error
+	executor *Executor
+}
 
-	rightEq := mulGt(sppe.PP.χ, C, D2.Exp(d), D1.Exp(dInv))
+func (fc FinalCheck) Verify() error {
+	if fc.err != nil {
+		return fc.err
+	}
 
-	if leftEq.Equals(rightEq) {
+	if e(fc.P, fc.Q).Equals(fc.T) {
 		return nil
 	}
 
 	return fmt.Errorf("proof invalid")
 }
 
+// BatchVerify verifies many final checks at once, by raising each of them to a random power and
+// comparing the multi-pairing of the left hand sides to the product of the right hand sides.
+func BatchVerify(checks []FinalCheck) error {
+	if len(checks) == 0 {
+		return nil
+	}
+
+	P := make(G1v, len(checks))
+	Q := make(G2v, len(checks))
+	T := make([]*math.Gt, len(checks))
+
+	for i, fc := range checks {
+		if fc.err != nil {
+			return fmt.Errorf("batch invalid")
+		}
+		ρ := RandomWeight()
+		P[i] = fc.P.Mul(ρ)
+		Q[i] = fc.Q
+		T[i] = fc.T.Exp(ρ)
+	}
+
+	if checks[0].executor.InnerProd(P, Q).Equals(mulGt(T...)) {
+		return nil
+	}
+
+	return fmt.Errorf("batch invalid")
+}
+
+// appendStatement appends the public parameters and the commitment to the transcript.
+// The digest of the last public parameters is chained to the digests of all previous ones.
+func appendStatement(t *Transcript, last PP, cmt Commitment) {
+	t.AppendBytes("pp", last.digest)
+	t.AppendGt("C", cmt.C)
+	t.AppendGt("D1", cmt.D1)
+	t.AppendGt("D2", cmt.D2)
+}
+
+// PaddedSize returns the size of the public parameters used for vectors of size n,
+// which is the smallest power of two that is not smaller than n.
+// Vectors are padded with identity elements up to that size, and proving costs as much as for the padded size.
+func PaddedSize(n int) int {
+	size := 1
+	for size < n {
+		size *= 2
+	}
+	return size
+}
+
 func NewPublicParams(n int) PP {
+	n = PaddedSize(n)
 	pp := PP{
 		Γ1: randomG1Vector(n),
 		Γ2: randomG2Vector(n),
@@ -175,6 +486,8 @@ func NewPublicParams(n int) PP {
 func GeneratePublicParams(n int) []PP {
 	var res []PP
 
+	n = PaddedSize(n)
+
 	pp := NewPublicParams(n)
 
 	for n > 0 {
@@ -233,13 +546,18 @@ func (pp PP) reducePP(n int) ReducePP {
 	}
 	m := n / 2
 
+	return pp.deriveReducePP(randomG1Vector(m), randomG2Vector(m))
+}
+
+// deriveReducePP computes the Δ values of the public parameters reduced to Γ1' and Γ2'.
+func (pp PP) deriveReducePP(Γ1Prime G1v, Γ2Prime G2v) ReducePP {
+	m := len(pp.Γ1) / 2
+
 	Γ1L := pp.Γ1[:m]
 	Γ1R := pp.Γ1[m:]
 	Γ2L := pp.Γ2[:m]
 	Γ2R := pp.Γ2[m:]
 
-	Γ1Prime := randomG1Vector(m)
-	Γ2Prime := randomG2Vector(m)
 	Δ1L := Γ1L.InnerProd(Γ2Prime)
 	Δ1R := Γ1R.InnerProd(Γ2Prime)
 	Δ2L := Γ1Prime.InnerProd(Γ2L)
@@ -255,6 +573,154 @@ func (pp PP) reducePP(n int) ReducePP {
 	}
 }
 
+const ppsVersion = 1
+
+// RawPPs is the versioned wire format of the public parameters returned by GeneratePublicParams.
+type RawPPs struct {
+	Version int
+	Params  []RawPP
+}
+
+// RawPP is the wire format of a single level of the public parameters.
+// Γ1' and Γ2' are not stored, as they are the Γ1 and Γ2 of the next level.
+type RawPP struct {
+	Digest             []byte
+	Γ1, Γ2             []byte
+	Chi                []byte
+	Δ1L, Δ1R, Δ2L, Δ2R []byte
+}
+
+func PPsBytes(pps []PP) []byte {
+	rpp := RawPPs{
+		Version: ppsVersion,
+	}
+
+	for _, pp := range pps {
+		raw := RawPP{
+			Digest: pp.digest,
+			Γ1:     pp.Γ1.Bytes(),
+			Γ2:     pp.Γ2.Bytes(),
+			Chi:    pp.χ.Bytes(),
+		}
+
+		if len(pp.Γ1) > 1 {
+			raw.Δ1L = pp.Δ1L.Bytes()
+			raw.Δ1R = pp.Δ1R.Bytes()
+			raw.Δ2L = pp.Δ2L.Bytes()
+			raw.Δ2R = pp.Δ2R.Bytes()
+		}
+
+		rpp.Params = append(rpp.Params, raw)
+	}
+
+	bytes, err := asn1.Marshal(rpp)
+	if err != nil {
+		panic(err)
+	}
+
+	return bytes
+}
+
+// PPsFromBytes loads public parameters serialized by PPsBytes.
+// The χ and Δ values of every level are recomputed from Γ1 and Γ2 of the level and of the next one,
+// and its digest is recomputed from that of the previous level; any mismatch with the stored ones is an error.
+// It is up to the caller to compare the digest of the last level against a trusted value.
+func PPsFromBytes(serialized []byte) ([]PP, error) {
+	var rpp RawPPs
+	rest, err := asn1.Unmarshal(serialized, &rpp)
+	if err != nil {
+		return nil, fmt.Errorf("failed unmarshaling public parameters: %v", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("trailing bytes after public parameters")
+	}
+
+	if rpp.Version != ppsVersion {
+		return nil, fmt.Errorf("unsupported public parameters version %d", rpp.Version)
+	}
+
+	if len(rpp.Params) == 0 {
+		return nil, fmt.Errorf("empty public parameters")
+	}
+
+	pps := make([]PP, len(rpp.Params))
+
+	for i, raw := range rpp.Params {
+		pp := PP{}
+
+		if pp.Γ1, err = G1vFromBytes(raw.Γ1); err != nil {
+			return nil, fmt.Errorf("level %d: invalid Γ1: %v", i, err)
+		}
+
+		if pp.Γ2, err = G2vFromBytes(raw.Γ2); err != nil {
+			return nil, fmt.Errorf("level %d: invalid Γ2: %v", i, err)
+		}
+
+		if pp.χ, err = GtFromBytes(raw.Chi); err != nil {
+			return nil, fmt.Errorf("level %d: invalid χ: %v", i, err)
+		}
+
+		if len(pp.Γ1) == 0 || len(pp.Γ1) != len(pp.Γ2) {
+			return nil, fmt.Errorf("level %d: Γ1 is of size %d but Γ2 is of size %d", i, len(pp.Γ1), len(pp.Γ2))
+		}
+
+		last := i == len(rpp.Params)-1
+
+		if last != (len(pp.Γ1) == 1) {
+			return nil, fmt.Errorf("level %d: unexpected size %d", i, len(pp.Γ1))
+		}
+
+		if i > 0 && 2*len(pp.Γ1) != len(pps[i-1].Γ1) {
+			return nil, fmt.Errorf("level %d: size %d is not half of the previous level", i, len(pp.Γ1))
+		}
+
+		if !last {
+			Δs := make([]*math.Gt, 4)
+			for j, b := range [][]byte{raw.Δ1L, raw.Δ1R, raw.Δ2L, raw.Δ2R} {
+				if Δs[j], err = GtFromBytes(b); err != nil {
+					return nil, fmt.Errorf("level %d: invalid Δ: %v", i, err)
+				}
+			}
+			pp.Δ1L, pp.Δ1R, pp.Δ2L, pp.Δ2R = Δs[0], Δs[1], Δs[2], Δs[3]
+		} else if len(raw.Δ1L)+len(raw.Δ1R)+len(raw.Δ2L)+len(raw.Δ2R) > 0 {
+			return nil, fmt.Errorf("level %d: last level should not have reduce parameters", i)
+		}
+
+		pps[i] = pp
+	}
+
+	for i := 0; i < len(pps)-1; i++ {
+		pps[i].Γ1Prime = pps[i+1].Γ1
+		pps[i].Γ2Prime = pps[i+1].Γ2
+	}
+
+	for i, pp := range pps {
+		if !pp.χ.Equals(pp.Γ1.InnerProd(pp.Γ2)) {
+			return nil, fmt.Errorf("level %d: χ does not match Γ1 and Γ2", i)
+		}
+
+		if i == len(pps)-1 {
+			continue
+		}
+
+		derived := pp.deriveReducePP(pp.Γ1Prime, pp.Γ2Prime)
+		if !pp.Δ1L.Equals(derived.Δ1L) || !pp.Δ1R.Equals(derived.Δ1R) || !pp.Δ2L.Equals(derived.Δ2L) || !pp.Δ2R.Equals(derived.Δ2R) {
+			return nil, fmt.Errorf("level %d: Δ does not match Γ1 and Γ2", i)
+		}
+	}
+
+	var prevDigest []byte
+	for i := range pps {
+		pps[i].digest = pps[i].Digest(prevDigest)
+		if !bytes.Equal(pps[i].digest, rpp.Params[i].Digest) {
+			return nil, fmt.Errorf("level %d: digest mismatch", i)
+		}
+		prevDigest = pps[i].digest
+	}
+
+	return pps, nil
+}
+
 type ScalarProductProofStep1Elements struct {
 	C, D1, D2 *math.Gt
 }
@@ -270,74 +736,302 @@ func ScalarProductProof(pp PP, w Witness) ScalarProductProofElements {
 	}
 }
 
+// VerifyReduce verifies a proof produced by Reduce.
 func VerifyReduce(pps []PP, commitment Commitment, proof Proof) error {
-	return verifyReduce(pps, commitment, proof.Step1Elements, proof.Step2Elements, proof.ScalarProductProofElements)
+	return VerifyReduceWithTranscript(NewTranscript(DoryLabel), pps, commitment, proof)
 }
 
-func verifyReduce(pps []PP, commitment Commitment, fromProver1 []ReduceProverStep1Elements, fromProver2 []ReduceProverStep2Elements, finalProof ScalarProductProofElements) error {
-	if len(pps) == 1 {
-		return finalProof.Verify(commitment)
+// VerifyReduceWithTranscript verifies a proof produced by ReduceWithTranscript,
+// given a transcript in the same state as the one given to the prover.
+func VerifyReduceWithTranscript(t *Transcript, pps []PP, commitment Commitment, proof Proof) error {
+	return PrepareVerification(t, pps, commitment, proof).Verify()
+}
+
+// PrepareVerification folds all rounds of a proof produced by ReduceWithTranscript into its final check,
+// which can then be verified on its own or in a batch along with other final checks.
+func PrepareVerification(t *Transcript, pps []PP, commitment Commitment, proof Proof) FinalCheck {
+	if err := checkProof(pps, commitment, proof); err != nil {
+		return FinalCheck{err: err}
 	}
+	appendStatement(t, pps[len(pps)-1], commitment)
+	fc := verifyReduce(t, pps, commitment, proof.Step1Elements, proof.Step2Elements, proof.ScalarProductProofElements, nil)
+	fc.executor = pps[0].executor
+	return fc
+}
 
-	pp := pps[0]
+// VerifyReduceHiding verifies a proof produced by ReduceHiding.
+func VerifyReduceHiding(pps []PP, commitment Commitment, proof HidingProof) error {
+	if err := checkProof(pps, commitment, proof.Proof); err != nil {
+		return err
+	}
+	he := proof.HidingElements
+	if he.P1 == nil || he.P2 == nil || he.Q == nil || he.R == nil || he.R1 == nil || he.R2 == nil || he.R3 == nil {
+		return fmt.Errorf("malformed proof: missing hiding elements")
+	}
+	t := NewTranscript(HidingDoryLabel)
+	appendStatement(t, pps[len(pps)-1], commitment)
+	return verifyReduce(t, pps, commitment, proof.Step1Elements, proof.Step2Elements, proof.ScalarProductProofElements, &proof.HidingElements).Verify()
+}
 
-	step1Elements := ReduceProverStep1Elements{
-		ppDigest: pp.digest,
-		C:        commitment.C,
-		D1:       commitment.D1,
-		D2:       commitment.D2,
-		D1L:      fromProver1[0].D1L,
-		D1R:      fromProver1[0].D1R,
-		D2L:      fromProver1[0].D2L,
-		D2R:      fromProver1[0].D2R,
+// verifyReduce derives all challenges first, and then computes the right hand side of the final check
+// in a single multi-exponentiation, by unrolling the commitment of every round into the elements it is made of:
+// C' = C χ D2^β D1^(1/β) C+^α C-^(1/α)
+// D1' = D1L^α D1R Δ1L^(αβ) Δ1R^β
+// D2' = D2L^(1/α) D2R Δ2L^(1/(αβ)) Δ2R^(1/β)
+// and the final check is e(E1 + dΓ1, E2 + Γ2/d) = χ C D2^d D1^(1/d).
+// If the proof is hiding, the final check is instead
+// e(E1 + dΓ1, E2 + Γ2/d) = χ R Q^c C^(c^2) (P2 D2^c)^d (P1 D1^c)^(1/d) HT^-(R3 + d R2 + R1/d).
+func verifyReduce(t *Transcript, pps []PP, commitment Commitment, fromProver1 []ReduceProverStep1Elements, fromProver2 []ReduceProverStep2Elements, finalProof ScalarProductProofElements, hiding *HidingElements) FinalCheck {
+	rounds := len(pps) - 1
+
+	α := make([]*math.Zr, rounds)
+	β := make([]*math.Zr, rounds)
+	for i := 0; i < rounds; i++ {
+		β[i] = fromProver1[i].challenge(t)
+		α[i] = fromProver2[i].challenge(t)
 	}
 
-	β := step1Elements.RO()
+	// The folded C is raised to c^2 and the folded D1, D2 to c if the proof is hiding, and are not raised otherwise
+	cScale, dScale := c.NewZrFromInt(1), c.NewZrFromInt(1)
+	if hiding != nil {
+		dScale = hiding.challenge(t)
+		cScale = mulZr(dScale, dScale)
+		hiding.appendResponses(t)
+	}
 
-	step2Elements := ReduceProverStep2Elements{
-		ReduceProverStep1ElementsDigest: step1Elements.digest,
-		Cminus:                          fromProver2[0].Cminus,
-		Cplus:                           fromProver2[0].Cplus,
+	// The public parameters are not part of the proof, bind them from the verifier's side
+	finalProof.PP = &pps[rounds]
+	d := finalProof.challenge(t)
+	dInv := inverse(d)
+
+	// D1 and D2 of round i are raised to 1/β and β, and the ones of the last round to 1/d and d
+	s1 := make([]*math.Zr, rounds+1)
+	s2 := make([]*math.Zr, rounds+1)
+	for i := 0; i < rounds; i++ {
+		s1[i] = mulZr(inverse(β[i]), cScale)
+		s2[i] = mulZr(β[i], cScale)
+	}
+	s1[rounds] = mulZr(dInv, dScale)
+	s2[rounds] = mulZr(d, dScale)
+
+	product := []*math.Gt{pps[rounds].χ}
+	var bases []*math.Gt
+	var exponents []*math.Zr
+
+	// term multiplies the right hand side by base^exponent
+	term := func(base *math.Gt, exponent *math.Zr) {
+		if exponent.Equals(c.NewZrFromInt(1)) {
+			product = append(product, base)
+			return
+		}
+		bases = append(bases, base)
+		exponents = append(exponents, exponent)
 	}
-	α := step2Elements.RO()
 
-	Cplus := fromProver2[0].Cplus
-	Cminus := fromProver2[0].Cminus
-	inverse_α := inverse(α)
-	inverse_β := inverse(β)
-	D1L := step1Elements.D1L
-	D1R := step1Elements.D1R
-	D2L := step1Elements.D2L
-	D2R := step1Elements.D2R
-	Δ1L := pp.Δ1L
-	Δ1R := pp.Δ1R
-	Δ2L := pp.Δ2L
-	Δ2R := pp.Δ2R
+	term(commitment.C, cScale)
+	term(commitment.D1, s1[0])
+	term(commitment.D2, s2[0])
 
-	Cprime := mulGt(commitment.C, pp.χ, commitment.D2.Exp(β), commitment.D1.Exp(inverse_β), Cplus.Exp(α), Cminus.Exp(inverse_α))
-	D1prime := mulGt(D1L.Exp(α), D1R, Δ1L.Exp(α).Exp(β), Δ1R.Exp(β))
-	D2prime := mulGt(D2L.Exp(inverse_α), D2R, Δ2L.Exp(inverse_α).Exp(inverse_β), Δ2R.Exp(inverse_β))
+	for i := 0; i < rounds; i++ {
+		pp := pps[i]
+		αInv, βInv := inverse(α[i]), inverse(β[i])
+		step1, step2 := fromProver1[i], fromProver2[i]
 
-	nextCommitment := Commitment{
-		C:  Cprime,
-		D1: D1prime,
-		D2: D2prime,
+		term(pp.χ, cScale)
+		term(step2.Cplus, mulZr(α[i], cScale))
+		term(step2.Cminus, mulZr(αInv, cScale))
+
+		term(step1.D1L, mulZr(α[i], s1[i+1]))
+		term(step1.D1R, s1[i+1])
+		term(pp.Δ1L, mulZr(α[i], β[i], s1[i+1]))
+		term(pp.Δ1R, mulZr(β[i], s1[i+1]))
+
+		term(step1.D2L, mulZr(αInv, s2[i+1]))
+		term(step1.D2R, s2[i+1])
+		term(pp.Δ2L, mulZr(αInv, βInv, s2[i+1]))
+		term(pp.Δ2R, mulZr(βInv, s2[i+1]))
+	}
+
+	if hiding != nil {
+		product = append(product, hiding.R)
+		term(hiding.Q, dScale)
+		term(hiding.P1, dInv)
+		term(hiding.P2, d)
+		term(blindingGenerator(), c.ModNeg(addZr(hiding.R3, mulZr(d, hiding.R2), mulZr(dInv, hiding.R1)), c.GroupOrder))
+	}
+
+	return FinalCheck{
+		P: addG1(finalProof.E1[0], finalProof.PP.Γ1[0].Mul(d)),
+		Q: addG2(finalProof.E2[0], finalProof.PP.Γ2[0].Mul(dInv)),
+		T: mulGt(append(product, MultiExpGt(bases, exponents))...),
+	}
+}
+
+// ErrParamsMismatch is returned when the public parameters are malformed,
+// or do not match the witness or the proof they are used with.
+var ErrParamsMismatch = errors.New("public parameters mismatch")
+
+// CheckPublicParams checks that every public parameters are half the size of the ones before them, down to size 1,
+// as generated by GeneratePublicParams.
+func CheckPublicParams(pps []PP) error {
+	if len(pps) == 0 {
+		return fmt.Errorf("%w: no public parameters", ErrParamsMismatch)
+	}
+
+	n := len(pps[0].Γ1)
+	for i, pp := range pps {
+		if len(pp.Γ1) != n || len(pp.Γ2) != n || pp.χ == nil {
+			return fmt.Errorf("%w: public parameters %d should be of size %d", ErrParamsMismatch, i, n)
+		}
+		if i < len(pps)-1 && (len(pp.Γ1Prime) != n/2 || len(pp.Γ2Prime) != n/2 || pp.Δ1L == nil || pp.Δ1R == nil || pp.Δ2L == nil || pp.Δ2R == nil) {
+			return fmt.Errorf("%w: public parameters %d cannot be reduced", ErrParamsMismatch, i)
+		}
+		n /= 2
 	}
 
-	return verifyReduce(pps[1:], nextCommitment, fromProver1[1:], fromProver2[1:], finalProof)
+	if len(pps[len(pps)-1].Γ1) != 1 {
+		return fmt.Errorf("%w: last public parameters should be of size 1", ErrParamsMismatch)
+	}
 
+	return nil
 }
 
+// checkProof checks that the proof has a round for every public parameters but the last,
+// so that it can be verified without any out of range access.
+func checkProof(pps []PP, commitment Commitment, proof Proof) error {
+	if err := CheckPublicParams(pps); err != nil {
+		return err
+	}
+
+	if commitment.C == nil || commitment.D1 == nil || commitment.D2 == nil {
+		return fmt.Errorf("malformed commitment")
+	}
+
+	return proof.CheckShape(pps)
+}
+
+// CheckShape checks that the proof has the number of rounds the public parameters call for, and no missing element.
+// Unlike Validate, it does not check that the elements are in their prime order subgroups,
+// which ProofFromBytes already ensures.
+func (p Proof) CheckShape(pps []PP) error {
+	rounds := len(pps) - 1
+	if len(p.Step1Elements) != rounds || len(p.Step2Elements) != rounds {
+		return fmt.Errorf("%w: proof has %d, %d rounds but public parameters have %d", ErrParamsMismatch, len(p.Step1Elements), len(p.Step2Elements), rounds)
+	}
+
+	for i := 0; i < rounds; i++ {
+		s1, s2 := p.Step1Elements[i], p.Step2Elements[i]
+		if s1.D1L == nil || s1.D1R == nil || s1.D2L == nil || s1.D2R == nil || s2.Cplus == nil || s2.Cminus == nil {
+			return fmt.Errorf("malformed proof: round %d is incomplete", i)
+		}
+	}
+
+	sppe := p.ScalarProductProofElements
+	if len(sppe.E1) != 1 || len(sppe.E2) != 1 || sppe.E1[0] == nil || sppe.E2[0] == nil {
+		return fmt.Errorf("malformed proof: E1, E2 should be of size 1")
+	}
+
+	return nil
+}
+
+// Validate checks that the proof has a round for every public parameters but the last,
+// and that all of its elements are present and in their prime order subgroups.
+func (p Proof) Validate(pps []PP) error {
+	if err := CheckPublicParams(pps); err != nil {
+		return err
+	}
+
+	if err := p.CheckShape(pps); err != nil {
+		return err
+	}
+
+	for i := range p.Step1Elements {
+		s1, s2 := p.Step1Elements[i], p.Step2Elements[i]
+		for j, gt := range []*math.Gt{s1.D1L, s1.D1R, s1.D2L, s1.D2R, s2.Cplus, s2.Cminus} {
+			if err := CheckGt(gt); err != nil {
+				return fmt.Errorf("malformed proof: round %d: element %d: %v", i, j, err)
+			}
+		}
+	}
+
+	if err := CheckG1(p.ScalarProductProofElements.E1[0]); err != nil {
+		return fmt.Errorf("malformed proof: invalid E1: %v", err)
+	}
+	if err := CheckG2(p.ScalarProductProofElements.E2[0]); err != nil {
+		return fmt.Errorf("malformed proof: invalid E2: %v", err)
+	}
+
+	return nil
+}
+
+// TryReduce is Reduce, but returns an error instead of panicking if the public parameters are malformed
+// or too small for the witness.
+func TryReduce(pps []PP, w Witness, commitment Commitment) (Proof, error) {
+	if err := CheckPublicParams(pps); err != nil {
+		return Proof{}, err
+	}
+
+	if n := len(pps[0].Γ1); len(w.V1) > n || len(w.V2) > n {
+		return Proof{}, fmt.Errorf("%w: witness of size %d, %d exceeds public parameters of size %d", ErrParamsMismatch, len(w.V1), len(w.V2), n)
+	}
+
+	return Reduce(pps, w, commitment), nil
+}
+
+// Reduce proves knowledge of the witness of the commitment.
 func Reduce(pps []PP, w Witness, commitment Commitment) Proof {
-	a, b, c := reduce(pps, w, commitment)
+	return ReduceWithTranscript(NewTranscript(DoryLabel), pps, w, commitment)
+}
+
+// ReduceWithTranscript proves knowledge of the witness of the commitment,
+// deriving all challenges from the given transcript:
+// First, the digest of the last public parameters and the commitment C, D1, D2 are appended.
+// In every round, D1L, D1R, D2L, D2R are appended and β is derived,
+// then C+, C- are appended and α is derived.
+// Finally, E1, E2 are appended and the challenge d of the scalar product proof is derived.
+func ReduceWithTranscript(t *Transcript, pps []PP, w Witness, commitment Commitment) Proof {
+	appendStatement(t, pps[len(pps)-1], commitment)
+	a, b, w, _ := reduce(nil, t, pps, w.pad(len(pps[0].Γ1)), nil, commitment)
 	return Proof{
 		Step1Elements:              a,
 		Step2Elements:              b,
-		ScalarProductProofElements: c,
+		ScalarProductProofElements: ScalarProductProof(pps[len(pps)-1], w),
 	}
 }
 
-func reduce(pps []PP, w Witness, commitment Commitment) ([]ReduceProverStep1Elements, []ReduceProverStep2Elements, ScalarProductProofElements) {
+// ReduceHiding proves knowledge of the witness of a hiding commitment in zero knowledge:
+// Every message of the reduce rounds is blinded, and instead of revealing the folded witness,
+// the last round is a sigma protocol that proves knowledge of it.
+func ReduceHiding(pps []PP, w HidingWitness, commitment Commitment) HidingProof {
+	return ReduceHidingWithRand(rand.Reader, pps, w, commitment)
+}
+
+// ReduceHidingWithRand is ReduceHiding with the blinders of the messages read from rnd.
+func ReduceHidingWithRand(rnd io.Reader, pps []PP, w HidingWitness, commitment Commitment) HidingProof {
+	t := NewTranscript(HidingDoryLabel)
+	appendStatement(t, pps[len(pps)-1], commitment)
+	a, b, folded, blinders := reduce(rnd, t, pps, w.Witness.pad(len(pps[0].Γ1)), &w.Blinders, commitment)
+	he, sppe := hidingScalarProductProof(rnd, t, pps[len(pps)-1], folded, *blinders)
+	return HidingProof{
+		Proof: Proof{
+			Step1Elements:              a,
+			Step2Elements:              b,
+			ScalarProductProofElements: sppe,
+		},
+		HidingElements: he,
+	}
+}
+
+// reduce runs the reduce rounds and returns their messages along with the folded witness.
+// Every round halves the vectors, hence they are expected to be padded to a power of two beforehand.
+// Odd-length vectors are not folded by themselves, which means the prover pays for the padded size:
+// a witness of 600 elements is reduced as one of 1024, with 1024 pairings in the first round instead of 600.
+// If blinders are given, the messages are blinded with randomness read from rnd and the folded blinders are returned as well.
+func reduce(rnd io.Reader, t *Transcript, pps []PP, w Witness, blinders *Blinders, commitment Commitment) ([]ReduceProverStep1Elements, []ReduceProverStep2Elements, Witness, *Blinders) {
+	if len(pps) == 1 {
+		return nil, nil, w, blinders
+	}
+
 	pp := pps[0]
 	m := len(pp.Γ1) / 2
 
@@ -355,24 +1049,31 @@ func reduce(pps []PP, w Witness, commitment Commitment) ([]ReduceProverStep1Elem
 	v2R := w.V2[m:]
 
 	// P --> V:
-	D1L := v1L.InnerProd(Γ2Prime)
-	D1R := v1R.InnerProd(Γ2Prime)
-	D2L := Γ1Prime.InnerProd(v2L)
-	D2R := Γ1Prime.InnerProd(v2R)
+	var D1L, D1R, D2L, D2R *math.Gt
+	pp.executor.Parallel(func() {
+		D1L = pp.executor.InnerProd(v1L, Γ2Prime)
+	}, func() {
+		D1R = pp.executor.InnerProd(v1R, Γ2Prime)
+	}, func() {
+		D2L = pp.executor.InnerProd(Γ1Prime, v2L)
+	}, func() {
+		D2R = pp.executor.InnerProd(Γ1Prime, v2R)
+	})
+
+	var r1L, r1R, r2L, r2R, rPlus, rMinus *math.Zr
+	if blinders != nil {
+		r1L, r1R, r2L, r2R = blind(rnd, D1L), blind(rnd, D1R), blind(rnd, D2L), blind(rnd, D2R)
+	}
 
 	// V --> P:
 	step1Elements := ReduceProverStep1Elements{
-		ppDigest: pp.digest,
-		C:        commitment.C,
-		D1:       commitment.D1,
-		D2:       commitment.D2,
-		D1L:      D1L,
-		D1R:      D1R,
-		D2L:      D2L,
-		D2R:      D2R,
+		D1L: D1L,
+		D1R: D1R,
+		D2L: D2L,
+		D2R: D2R,
 	}
 
-	β := step1Elements.RO()
+	β := step1Elements.challenge(t)
 	inverse_β := inverse(β)
 
 	// P:
@@ -385,15 +1086,22 @@ func reduce(pps []PP, w Witness, commitment Commitment) ([]ReduceProverStep1Elem
 	v2R = v2[m:]
 
 	// P --> V:
-	Cplus := v1L.InnerProd(v2R)
-	Cminus := v1R.InnerProd(v2L)
+	var Cplus, Cminus *math.Gt
+	pp.executor.Parallel(func() {
+		Cplus = pp.executor.InnerProd(v1L, v2R)
+	}, func() {
+		Cminus = pp.executor.InnerProd(v1R, v2L)
+	})
+
+	if blinders != nil {
+		rPlus, rMinus = blind(rnd, Cplus), blind(rnd, Cminus)
+	}
 
 	step2Elements := ReduceProverStep2Elements{
-		ReduceProverStep1ElementsDigest: step1Elements.digest,
-		Cminus:                          Cminus,
-		Cplus:                           Cplus,
+		Cminus: Cminus,
+		Cplus:  Cplus,
 	}
-	α := step2Elements.RO()
+	α := step2Elements.challenge(t)
 
 	inverse_α := inverse(α)
 
@@ -415,11 +1123,16 @@ func reduce(pps []PP, w Witness, commitment Commitment) ([]ReduceProverStep1Elem
 		D2: D2prime,
 	}
 
-	if m == 1 {
-		return []ReduceProverStep1Elements{step1Elements}, []ReduceProverStep2Elements{step2Elements}, ScalarProductProof(pps[1], nextWitness)
+	var nextBlinders *Blinders
+	if blinders != nil {
+		nextBlinders = &Blinders{
+			C:  addZr(blinders.C, mulZr(blinders.D2, β), mulZr(blinders.D1, inverse_β), mulZr(rPlus, α), mulZr(rMinus, inverse_α)),
+			D1: addZr(mulZr(r1L, α), r1R),
+			D2: addZr(mulZr(r2L, inverse_α), r2R),
+		}
 	}
 
-	step1Aggregated, step2Aggregated, scalarProductProof := reduce(pps[1:], nextWitness, nextCommitment)
+	step1Aggregated, step2Aggregated, finalWitness, finalBlinders := reduce(rnd, t, pps[1:], nextWitness, nextBlinders, nextCommitment)
 
 	var res1 []ReduceProverStep1Elements
 	var res2 []ReduceProverStep2Elements
@@ -427,54 +1140,89 @@ func reduce(pps []PP, w Witness, commitment Commitment) ([]ReduceProverStep1Elem
 	res1 = append([]ReduceProverStep1Elements{step1Elements}, step1Aggregated...)
 	res2 = append([]ReduceProverStep2Elements{step2Elements}, step2Aggregated...)
 
-	return res1, res2, scalarProductProof
+	return res1, res2, finalWitness, finalBlinders
 }
 
-type ReduceProverStep1Elements struct {
-	ppDigest           []byte
-	digest             []byte
-	D1L, D1R, D2L, D2R *math.Gt
-	C, D1, D2          *math.Gt
+// blind multiplies x by a random power of the blinding generator, and returns the exponent.
+func blind(rnd io.Reader, x *math.Gt) *math.Zr {
+	r := MustRandomZr(rnd)
+	x.Mul(blindingGenerator().Exp(r))
+	return r
 }
 
-func (x ReduceProverStep1Elements) Bytes() [][]byte {
-	var bytes [][]byte
-	bytes = append(bytes, x.ppDigest)
-	bytes = append(bytes, x.D1L.Bytes())
-	bytes = append(bytes, x.D1R.Bytes())
-	bytes = append(bytes, x.D2L.Bytes())
-	bytes = append(bytes, x.D2R.Bytes())
-	bytes = append(bytes, x.C.Bytes())
-	bytes = append(bytes, x.D1.Bytes())
-	bytes = append(bytes, x.D2.Bytes())
-
-	return bytes
+// HidingElements are the messages of the sigma protocol that proves knowledge of
+// v1, v2 and the blinders of C = e(v1, v2) HT^rC, D1 = e(v1, Γ2) HT^rD1, D2 = e(Γ1, v2) HT^rD2.
+// The prover commits to random d1, d2 with P1, P2, Q and R, and after the challenge c is derived,
+// reveals E1 = d1 + c v1 and E2 = d2 + c v2 along with the blinders R1, R2, R3 of
+// e(E1, Γ2), e(Γ1, E2) and e(E1, E2) respectively.
+type HidingElements struct {
+	P1, P2, Q, R *math.Gt
+	R1, R2, R3   *math.Zr
 }
 
-func (x *ReduceProverStep1Elements) RO() *math.Zr {
-	x.digest = sha256Digest(x.Bytes())
-	return FieldElementFromBytes(x.digest)
+// challenge appends P1, P2, Q, R to the transcript and derives the challenge c.
+func (he HidingElements) challenge(t *Transcript) *math.Zr {
+	t.AppendGt("P1", he.P1)
+	t.AppendGt("P2", he.P2)
+	t.AppendGt("Q", he.Q)
+	t.AppendGt("R", he.R)
+	return t.ChallengeZr("c")
 }
 
-type ReduceProverStep2Elements struct {
-	ReduceProverStep1ElementsDigest []byte
-	Cplus, Cminus                   *math.Gt
+func (he HidingElements) appendResponses(t *Transcript) {
+	t.AppendZr("R1", he.R1)
+	t.AppendZr("R2", he.R2)
+	t.AppendZr("R3", he.R3)
 }
 
-func (x ReduceProverStep2Elements) Bytes() [][]byte {
-	if len(x.ReduceProverStep1ElementsDigest) == 0 {
-		panic("un-initialized ReduceProverStep1ElementsDigest")
+func hidingScalarProductProof(rnd io.Reader, t *Transcript, pp PP, w Witness, b Blinders) (HidingElements, ScalarProductProofElements) {
+	d1 := c.GenG1.Mul(MustRandomZr(rnd))
+	d2 := c.GenG2.Mul(MustRandomZr(rnd))
+
+	he := HidingElements{
+		P1: e(d1, pp.Γ2[0]),
+		P2: e(pp.Γ1[0], d2),
+		Q:  mulGt(e(d1, w.V2[0]), e(w.V1[0], d2)),
+		R:  e(d1, d2),
 	}
-	var bytes [][]byte
-	bytes = append(bytes, x.Cplus.Bytes())
-	bytes = append(bytes, x.Cminus.Bytes())
-	bytes = append(bytes, x.ReduceProverStep1ElementsDigest)
 
-	return bytes
+	rP1, rP2, rQ, rR := blind(rnd, he.P1), blind(rnd, he.P2), blind(rnd, he.Q), blind(rnd, he.R)
+
+	challenge := he.challenge(t)
+
+	he.R1 = addZr(rP1, mulZr(challenge, b.D1))
+	he.R2 = addZr(rP2, mulZr(challenge, b.D2))
+	he.R3 = addZr(rR, mulZr(challenge, rQ), mulZr(challenge, challenge, b.C))
+
+	return he, ScalarProductProofElements{
+		PP: &pp,
+		E1: G1v{addG1(d1, w.V1[0].Mul(challenge))},
+		E2: G2v{addG2(d2, w.V2[0].Mul(challenge))},
+	}
+}
+
+type ReduceProverStep1Elements struct {
+	D1L, D1R, D2L, D2R *math.Gt
 }
 
-func (x ReduceProverStep2Elements) RO() *math.Zr {
-	return FieldElementFromBytes(sha256Digest(x.Bytes()))
+// challenge appends the first message of the round to the transcript and derives β.
+func (x ReduceProverStep1Elements) challenge(t *Transcript) *math.Zr {
+	t.AppendGt("D1L", x.D1L)
+	t.AppendGt("D1R", x.D1R)
+	t.AppendGt("D2L", x.D2L)
+	t.AppendGt("D2R", x.D2R)
+	return t.ChallengeZr("β")
+}
+
+type ReduceProverStep2Elements struct {
+	Cplus, Cminus *math.Gt
+}
+
+// challenge appends the second message of the round to the transcript and derives α.
+func (x ReduceProverStep2Elements) challenge(t *Transcript) *math.Zr {
+	t.AppendGt("C+", x.Cplus)
+	t.AppendGt("C-", x.Cminus)
+	return t.ChallengeZr("α")
 }
 
 func e(g1 *math.G1, g2 *math.G2) *math.Gt {
@@ -495,6 +1243,26 @@ func mulGt(xs ...*math.Gt) *math.Gt {
 	return prod
 }
 
+func addZr(xs ...*math.Zr) *math.Zr {
+	z := c.NewZrFromInt(0)
+	for _, x := range xs {
+		z = z.Plus(x)
+	}
+	z.Mod(c.GroupOrder)
+
+	return z
+}
+
+func mulZr(xs ...*math.Zr) *math.Zr {
+	z := c.NewZrFromInt(1)
+	for _, x := range xs {
+		z = z.Mul(x)
+		z.Mod(c.GroupOrder)
+	}
+
+	return z
+}
+
 func addG1(xs ...*math.G1) *math.G1 {
 	z := xs[0].Copy()
 	for i := 1; i < len(xs); i++ {
@@ -529,10 +1297,6 @@ func randomG2Vector(n int) G2v {
 	return v
 }
 
-func randomFE() *math.Zr {
-	return c.NewRandomZr(rand.Reader)
-}
-
 func randomBytes() []byte {
 	buff := make([]byte, lambda)
 	_, err := rand.Read(buff)
@@ -563,7 +1327,11 @@ func psuedoRandomG1(n int, i int) *math.G1 {
 }
 
 func psuedoRandomG2(n int, i int) *math.G2 {
-	g2, err := bn254.HashToCurveG2Svdw(sha256Digest([][]byte{[]byte("Dory"), {byte(n), byte(n >> 8)}, {byte(i), byte(i >> 8)}}), []byte{})
+	return hashToG2(sha256Digest([][]byte{[]byte("Dory"), {byte(n), byte(n >> 8)}, {byte(i), byte(i >> 8)}}))
+}
+
+func hashToG2(digest []byte) *math.G2 {
+	g2, err := bn254.HashToCurveG2Svdw(digest, []byte{})
 	if err != nil {
 		panic(err)
 	}
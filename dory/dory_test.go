@@ -7,7 +7,11 @@ SPDX-License-Identifier: Apache-2.0
 package dory
 
 import (
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	mrand "math/rand"
 	"privacy-perserving-audit/common"
 	"testing"
 	"time"
@@ -38,6 +42,20 @@ func TestScalarProductProof(t *testing.T) {
 
 	fmt.Println(proofTime / 100)
 	fmt.Println(verificationTime / 100)
+
+	// The challenge is pinned, and depends on E1, E2 and the label of the transcript
+	generators := ScalarProductProofElements{E1: common.G1v{c.GenG1}, E2: common.G2v{c.GenG2}}
+	d := generators.challenge(common.NewTranscript(common.DoryLabel))
+	assert.Equal(t, "233ab34eecf7ee7b6234622d24005c455c588c2e1a226a13388bdeddf65d4ec7", hex.EncodeToString(d.Bytes()))
+	assert.False(t, d.Equals(generators.challenge(common.NewTranscript(common.HidingDoryLabel))))
+
+	generators.E2 = common.G2v{c.GenG2.Mul(c.NewZrFromInt(2))}
+	assert.False(t, d.Equals(generators.challenge(common.NewTranscript(common.DoryLabel))))
+
+	proof := ScalarProductProof(PP, witness)
+
+	proof.E1 = proof.E1.Mul(c.NewZrFromInt(2))
+	assert.EqualError(t, proof.Verify(cmt), "proof invalid")
 }
 
 func TestInnerProd(t *testing.T) {
@@ -96,6 +114,261 @@ func TestDoryReduce(t *testing.T) {
 	fmt.Println(verificationTime / 100)
 }
 
+func TestDoryReduceNonPowerOfTwo(t *testing.T) {
+	pps := GeneratePublicParams(5)
+	assert.Len(t, pps, 4)
+	assert.Len(t, pps[0].Γ1, 8)
+	assert.Equal(t, pps[0].Digest(nil), GeneratePublicParams(8)[0].Digest(nil))
+
+	v1 := randomG1Vector(5)
+	v2 := randomG2Vector(5)
+
+	cmt, witness := Commit(v1, v2, pps[0])
+	assert.True(t, cmt.C.Equals(v1.InnerProd(v2)))
+
+	proof := Reduce(pps, witness, cmt)
+	assert.NoError(t, VerifyReduce(pps, cmt, proof))
+
+	proof = Reduce(pps, Witness{V1: v1, V2: v2}, cmt)
+	assert.NoError(t, VerifyReduce(pps, cmt, proof))
+}
+
+func TestVerifyReduceTampered(t *testing.T) {
+	pps := GeneratePublicParams(4)
+	cmt, witness := Commit(common.G1v{randomG1(), randomG1(), randomG1(), randomG1()}, common.G2v{randomG2(), randomG2(), randomG2(), randomG2()}, pps[0])
+	proof := Reduce(pps, witness, cmt)
+	assert.NoError(t, VerifyReduce(pps, cmt, proof))
+
+	// Swapping elements within a round invalidates the proof
+	for i := range proof.Step1Elements {
+		tampered := Proof{
+			Step1Elements:              append([]ReduceProverStep1Elements{}, proof.Step1Elements...),
+			Step2Elements:              append([]ReduceProverStep2Elements{}, proof.Step2Elements...),
+			ScalarProductProofElements: proof.ScalarProductProofElements,
+		}
+		tampered.Step1Elements[i].D1L, tampered.Step1Elements[i].D1R = proof.Step1Elements[i].D1R, proof.Step1Elements[i].D1L
+		assert.EqualError(t, VerifyReduce(pps, cmt, tampered), "proof invalid")
+
+		tampered.Step1Elements[i] = proof.Step1Elements[i]
+		tampered.Step2Elements[i].Cplus, tampered.Step2Elements[i].Cminus = proof.Step2Elements[i].Cminus, proof.Step2Elements[i].Cplus
+		assert.EqualError(t, VerifyReduce(pps, cmt, tampered), "proof invalid")
+	}
+
+	cmt.D1, cmt.D2 = cmt.D2, cmt.D1
+	assert.EqualError(t, VerifyReduce(pps, cmt, proof), "proof invalid")
+}
+
+func TestBatchVerify(t *testing.T) {
+	pps := GeneratePublicParams(4)
+
+	var checks []FinalCheck
+	for i := 0; i < 3; i++ {
+		v1, v2 := common.G1v{randomG1(), randomG1(), randomG1()}, common.G2v{randomG2(), randomG2(), randomG2()}
+		cmt, witness := Commit(v1, v2, pps[0])
+		proof := Reduce(pps, witness, cmt)
+		checks = append(checks, PrepareVerification(common.NewTranscript(common.DoryLabel), pps, cmt, proof))
+	}
+
+	assert.NoError(t, BatchVerify(checks))
+
+	checks[1].T = checks[0].T
+	assert.EqualError(t, BatchVerify(checks), "batch invalid")
+	assert.EqualError(t, checks[1].Verify(), "proof invalid")
+}
+
+func TestDoryReduceHiding(t *testing.T) {
+	for _, n := range []int{1, 3, 8} {
+		pps := GeneratePublicParams(n)
+		v1, v2 := make(common.G1v, n), make(common.G2v, n)
+		for i := 0; i < n; i++ {
+			v1[i], v2[i] = randomG1(), randomG2()
+		}
+
+		cmt, witness := CommitHiding(v1, v2, pps[0])
+		assert.False(t, cmt.C.Equals(v1.InnerProd(v2)))
+
+		proof := ReduceHiding(pps, witness, cmt)
+		assert.NoError(t, VerifyReduceHiding(pps, cmt, proof))
+		assert.False(t, proof.ScalarProductProofElements.E1[0].Equals(v1[0]))
+
+		loaded, err := HidingProofFromBytes(proof.Bytes())
+		assert.NoError(t, err)
+		assert.NoError(t, VerifyReduceHiding(pps, cmt, loaded))
+
+		// Neither the blinders nor the mode can be swapped
+		unblinded, _ := Commit(v1, v2, pps[0])
+		assert.EqualError(t, VerifyReduceHiding(pps, unblinded, proof), "proof invalid")
+		assert.EqualError(t, VerifyReduce(pps, cmt, proof.Proof), "proof invalid")
+
+		proof.R1 = proof.R2
+		assert.EqualError(t, VerifyReduceHiding(pps, cmt, proof), "proof invalid")
+	}
+}
+
+func TestReduceHidingWithRand(t *testing.T) {
+	pps := GeneratePublicParams(4)
+	v1, v2 := randomG1Vector(4), randomG2Vector(4)
+
+	cmt1, w1 := CommitHidingWithRand(mrand.New(mrand.NewSource(1)), v1, v2, pps[0])
+	cmt2, w2 := CommitHidingWithRand(mrand.New(mrand.NewSource(1)), v1, v2, pps[0])
+	assert.True(t, cmt1.C.Equals(cmt2.C))
+	assert.True(t, w1.D2.Equals(w2.D2))
+
+	proof1 := ReduceHidingWithRand(mrand.New(mrand.NewSource(2)), pps, w1, cmt1)
+	proof2 := ReduceHidingWithRand(mrand.New(mrand.NewSource(2)), pps, w2, cmt2)
+	assert.Equal(t, proof1.Bytes(), proof2.Bytes())
+	assert.NoError(t, VerifyReduceHiding(pps, cmt1, proof1))
+}
+
+func TestTryReduce(t *testing.T) {
+	pps := GeneratePublicParams(4)
+	cmt, witness := Commit(randomG1Vector(4), randomG2Vector(4), pps[0])
+
+	proof, err := TryReduce(pps, witness, cmt)
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyReduce(pps, cmt, proof))
+
+	_, err = TryReduce(pps[1:], witness, cmt)
+	assert.True(t, errors.Is(err, ErrParamsMismatch))
+
+	_, err = TryReduce(pps[:2], witness, cmt)
+	assert.True(t, errors.Is(err, ErrParamsMismatch))
+
+	_, err = TryReduce(nil, witness, cmt)
+	assert.True(t, errors.Is(err, ErrParamsMismatch))
+
+	// Malformed proofs are rejected rather than crashing the verifier
+	err = VerifyReduce(pps[1:], cmt, proof)
+	assert.True(t, errors.Is(err, ErrParamsMismatch))
+
+	truncated := proof
+	truncated.Step2Elements = truncated.Step2Elements[:1]
+	assert.True(t, errors.Is(VerifyReduce(pps, cmt, truncated), ErrParamsMismatch))
+
+	truncated = proof
+	truncated.ScalarProductProofElements.E1 = nil
+	assert.EqualError(t, VerifyReduce(pps, cmt, truncated), "malformed proof: E1, E2 should be of size 1")
+
+	assert.EqualError(t, VerifyReduce(pps, Commitment{}, proof), "malformed commitment")
+
+	fc := PrepareVerification(common.NewTranscript(common.DoryLabel), pps, cmt, truncated)
+	assert.EqualError(t, BatchVerify([]FinalCheck{fc}), "batch invalid")
+}
+
+func TestProofFromBytes(t *testing.T) {
+	pps := GeneratePublicParams(4)
+	cmt, witness := Commit(randomG1Vector(4), randomG2Vector(4), pps[0])
+
+	proof := Reduce(pps, witness, cmt)
+	raw := proof.Bytes()
+
+	parsed, err := ProofFromBytes(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, parsed.Bytes())
+	assert.NoError(t, VerifyReduce(pps, cmt, parsed))
+
+	_, err = ProofFromBytes(raw[:len(raw)-1])
+	assert.Error(t, err)
+
+	// A deserialized proof carries no public parameters, and is validated against the verifier's
+	assert.NoError(t, parsed.Validate(pps))
+	assert.EqualError(t, parsed.ScalarProductProofElements.Verify(cmt), "scalar product proof has no public parameters")
+	assert.True(t, errors.Is(parsed.Validate(pps[1:]), ErrParamsMismatch))
+
+	truncated := parsed
+	truncated.Step2Elements = truncated.Step2Elements[1:]
+	assert.PanicsWithValue(t, "malformed proof: 2 step 1 rounds but 1 step 2 rounds", func() { truncated.Bytes() })
+
+	parsed.ScalarProductProofElements.E2 = common.G2v{nil}
+	assert.EqualError(t, parsed.Validate(pps), "malformed proof: E1, E2 should be of size 1")
+	assert.Error(t, VerifyReduce(pps, cmt, parsed))
+}
+
+func TestProofEncodingSize(t *testing.T) {
+	pps := GeneratePublicParams(16)
+	cmt, witness := Commit(randomG1Vector(16), randomG2Vector(16), pps[0])
+
+	proof := Reduce(pps, witness, cmt)
+
+	parsed, err := ProofFromBytes(proof.Bytes())
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyReduce(pps, cmt, parsed))
+
+	// The nested encoding used to carry, for every round, the digest of the public parameters
+	// and the intermediate commitment C, D1, D2, which the verifier recomputes by itself
+	digest := make([]byte, 32)
+	var step1, step2 [][][]byte
+	for i := range proof.Step1Elements {
+		s1, s2 := proof.Step1Elements[i], proof.Step2Elements[i]
+		step1 = append(step1, [][]byte{digest, s1.D1L.Bytes(), s1.D1R.Bytes(), s1.D2L.Bytes(), s1.D2R.Bytes(), cmt.C.Bytes(), cmt.D1.Bytes(), cmt.D2.Bytes()})
+		step2 = append(step2, [][]byte{s2.Cplus.Bytes(), s2.Cminus.Bytes(), digest})
+	}
+
+	nested, err := asn1.Marshal(struct {
+		Step1Elements              [][][]byte
+		Step2Elements              [][][]byte
+		ScalarProductProofElements []byte
+	}{
+		Step1Elements:              step1,
+		Step2Elements:              step2,
+		ScalarProductProofElements: proof.ScalarProductProofElements.Bytes(),
+	})
+	assert.NoError(t, err)
+
+	assert.Less(t, len(proof.Bytes()), len(nested))
+	// Every round carries six elements of Gt
+	assert.Less(t, len(proof.Bytes()), len(proof.Step1Elements)*6*(len(cmt.C.Bytes())+8)+len(proof.ScalarProductProofElements.Bytes()))
+}
+
+func TestPPsFromBytes(t *testing.T) {
+	pps := GeneratePublicParams(4)
+	raw := PPsBytes(pps)
+
+	loaded, err := PPsFromBytes(raw)
+	assert.NoError(t, err)
+	assert.Len(t, loaded, len(pps))
+	assert.Equal(t, raw, PPsBytes(loaded))
+
+	for i := range pps {
+		assert.Equal(t, pps[i].Digest(nil), loaded[i].Digest(nil))
+	}
+
+	cmt, witness := Commit(randomG1Vector(4), randomG2Vector(4), pps[0])
+	assert.NoError(t, VerifyReduce(loaded, cmt, Reduce(pps, witness, cmt)))
+
+	pps[1].digest = pps[2].digest
+	_, err = PPsFromBytes(PPsBytes(pps))
+	assert.EqualError(t, err, "level 1: digest mismatch")
+
+	// Digests are chained, so a suffix of the levels cannot be loaded on its own
+	_, err = PPsFromBytes(PPsBytes(GeneratePublicParams(4)[1:]))
+	assert.EqualError(t, err, "level 0: digest mismatch")
+
+	_, err = PPsFromBytes(PPsBytes(pps[:2]))
+	assert.EqualError(t, err, "level 1: unexpected size 2")
+
+	// Tampered values are detected even if the digests are recomputed over them
+	rehash := func(pps []PP) []PP {
+		var prevDigest []byte
+		for i := range pps {
+			pps[i].digest = nil
+			pps[i].digest = pps[i].Digest(prevDigest)
+			prevDigest = pps[i].digest
+		}
+		return pps
+	}
+
+	tampered := append([]PP{}, loaded...)
+	tampered[1].χ = tampered[0].χ
+	_, err = PPsFromBytes(PPsBytes(rehash(tampered)))
+	assert.EqualError(t, err, "level 1: χ does not match Γ1 and Γ2")
+
+	tampered = append([]PP{}, loaded...)
+	tampered[0].Δ2R = tampered[0].Δ1L
+	_, err = PPsFromBytes(PPsBytes(rehash(tampered)))
+	assert.EqualError(t, err, "level 0: Δ does not match Γ1 and Γ2")
+}
+
 func randomG1() *math.G1 {
 	return c.HashToG1(randomBytes())
 }
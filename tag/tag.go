@@ -11,6 +11,7 @@ import (
 	"crypto/sha256"
 	"encoding/asn1"
 	"fmt"
+	"io"
 	. "privacy-perserving-audit/common"
 
 	math "github.com/IBM/mathlib"
@@ -31,14 +32,33 @@ type Witness struct {
 }
 
 func Commit(sk *math.Zr) (*Witness, *math.G1) {
+	return CommitWithRand(rand.Reader, sk)
+}
+
+// CommitWithRand commits to sk like Commit does, with randomness read from rnd.
+func CommitWithRand(rnd io.Reader, sk *math.Zr) (*Witness, *math.G1) {
+	w, com, err := TryCommitWithRand(rnd, sk)
+	if err != nil {
+		panic(err)
+	}
+	return w, com
+}
+
+// TryCommitWithRand is CommitWithRand, but returns an error instead of panicking if rnd fails.
+func TryCommitWithRand(rnd io.Reader, sk *math.Zr) (*Witness, *math.G1, error) {
+	r, err := RandomZr(rnd)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	w := &Witness{
-		R: *curve.NewRandomZr(rand.Reader),
+		R: *r,
 	}
 
 	com := curve.GenG1.Mul(sk)
 	com.Add(H().Mul(&w.R))
 
-	return w, com
+	return w, com, nil
 }
 
 func Tag(sk *math.Zr, prefix []byte) *math.G1 {
@@ -46,24 +66,162 @@ func Tag(sk *math.Zr, prefix []byte) *math.G1 {
 }
 
 func NewProof(prefix []byte, sk *math.Zr, w *Witness, additionalContext ...[]byte) Proof {
-	ar, br := curve.NewRandomZr(rand.Reader), curve.NewRandomZr(rand.Reader)
+	return NewProofWithTranscript(ContextTranscript(additionalContext...), prefix, sk, w)
+}
+
+// NewProofWithTranscript proves the tag and the commitment of sk are consistent,
+// deriving the challenge from the given transcript after appending the statement and the proof commitments to it.
+func NewProofWithTranscript(t *Transcript, prefix []byte, sk *math.Zr, w *Witness) Proof {
+	return NewProofWithRand(rand.Reader, t, prefix, sk, w)
+}
+
+// NewProofWithRand is NewProofWithTranscript with randomness read from rnd.
+func NewProofWithRand(rnd io.Reader, t *Transcript, prefix []byte, sk *math.Zr, w *Witness) Proof {
+	π, err := TryNewProofWithRand(rnd, t, prefix, sk, w)
+	if err != nil {
+		panic(err)
+	}
+	return π
+}
+
+// TryNewProofWithRand is NewProofWithRand, but returns an error instead of panicking if rnd fails.
+func TryNewProofWithRand(rnd io.Reader, t *Transcript, prefix []byte, sk *math.Zr, w *Witness) (Proof, error) {
+	ar, err := RandomZr(rnd)
+	if err != nil {
+		return Proof{}, err
+	}
+	return newProof(rnd, t, prefix, sk, w, ar)
+}
+
+func newProof(rnd io.Reader, t *Transcript, prefix []byte, sk *math.Zr, w *Witness, ar *math.Zr) (Proof, error) {
+	br, err := RandomZr(rnd)
+	if err != nil {
+		return Proof{}, err
+	}
+
+	com := curve.GenG1.Mul(sk)
+	com.Add(H().Mul(&w.R))
+	appendStatement(t, prefix, Tag(sk, prefix), com)
 
 	A := curve.HashToG1(sha256Digest(prefix)).Mul(ar)
 	B := curve.GenG1.Mul(ar)
 	B.Add(H().Mul(br))
 
-	hashInput := buildHashContext(A, B, additionalContext)
-	c := hashToZr(hashInput...)
+	c := challenge(t, A, B)
 
 	a := ar.Plus(sk.Mul(c))
+	a.Mod(curve.GroupOrder)
 	b := br.Plus(w.R.Mul(c))
+	b.Mod(curve.GroupOrder)
 
 	return Proof{
 		A: A,
 		B: B,
 		a: a,
 		b: b,
+	}, nil
+}
+
+// Trace is the trace tag of a message, sk (g + c P), where c is derived from the prefix and the message,
+// and P is hashed from the prefix independently of the base of the tag.
+// The trace tags of two distinct messages under the same prefix reveal sk P, and then the public key.
+type Trace struct {
+	Tag *math.G1
+	// C is the commitment of the proof that the trace tag and the tag are of the same key
+	C *math.G1
+}
+
+// TraceTag returns the trace tag of the message under the given prefix.
+func TraceTag(sk *math.Zr, prefix, m []byte) *math.G1 {
+	return traceBase(prefix, m).Mul(sk)
+}
+
+func traceBase(prefix, m []byte) *math.G1 {
+	base := traceGenerator(prefix).Mul(traceChallenge(prefix, m))
+	base.Add(curve.GenG1)
+	return base
+}
+
+// traceGenerator hashes a longer input than Tag does, hence it never coincides with the base of a tag.
+func traceGenerator(prefix []byte) *math.G1 {
+	return curve.HashToG1(append(sha256Digest(prefix), []byte("trace")...))
+}
+
+func traceChallenge(prefix, m []byte) *math.Zr {
+	t := NewTranscript(TraceLabel)
+	t.AppendBytes("prefix", prefix)
+	t.AppendBytes("message", m)
+	return t.ChallengeZr("c")
+}
+
+// NewTraceableProofWithTranscript proves the tag, the trace tag of m and the commitment of sk are consistent.
+func NewTraceableProofWithTranscript(t *Transcript, prefix, m []byte, sk *math.Zr, w *Witness) (Proof, Trace) {
+	return NewTraceableProofWithRand(rand.Reader, t, prefix, m, sk, w)
+}
+
+// NewTraceableProofWithRand is NewTraceableProofWithTranscript with randomness read from rnd.
+func NewTraceableProofWithRand(rnd io.Reader, t *Transcript, prefix, m []byte, sk *math.Zr, w *Witness) (Proof, Trace) {
+	π, trace, err := TryNewTraceableProofWithRand(rnd, t, prefix, m, sk, w)
+	if err != nil {
+		panic(err)
 	}
+	return π, trace
+}
+
+// TryNewTraceableProofWithRand is NewTraceableProofWithRand, but returns an error instead of panicking if rnd fails.
+func TryNewTraceableProofWithRand(rnd io.Reader, t *Transcript, prefix, m []byte, sk *math.Zr, w *Witness) (Proof, Trace, error) {
+	ar, err := RandomZr(rnd)
+	if err != nil {
+		return Proof{}, Trace{}, err
+	}
+
+	trace := Trace{
+		Tag: TraceTag(sk, prefix, m),
+		C:   traceBase(prefix, m).Mul(ar),
+	}
+	appendTrace(t, trace)
+
+	π, err := newProof(rnd, t, prefix, sk, w, ar)
+	if err != nil {
+		return Proof{}, Trace{}, err
+	}
+
+	return π, trace, nil
+}
+
+// PrepareTraceableVerification is PrepareVerification for a proof produced by NewTraceableProofWithTranscript.
+func (p Proof) PrepareTraceableVerification(t *Transcript, tag *math.G1, com *math.G1, prefix, m []byte, trace Trace) Check {
+	appendTrace(t, trace)
+	ch := p.PrepareVerification(t, tag, com, prefix)
+	ch.traceBase = traceBase(prefix, m)
+	ch.trace = trace
+	return ch
+}
+
+// TracePublicKey computes the public key of the signer of two distinct messages under the same prefix,
+// given their trace tags.
+func TracePublicKey(prefix, m1 []byte, trace1 *math.G1, m2 []byte, trace2 *math.G1) (*math.G1, error) {
+	c1, c2 := traceChallenge(prefix, m1), traceChallenge(prefix, m2)
+	if c1.Equals(c2) {
+		return nil, fmt.Errorf("messages are identical")
+	}
+
+	// sk P = (trace1 - trace2) / (c1 - c2)
+	d := curve.ModSub(c1, c2, curve.GroupOrder)
+	d.InvModP(curve.GroupOrder)
+	skP := trace1.Copy()
+	skP.Sub(trace2)
+	skP = skP.Mul(d)
+
+	// sk g = trace1 - c1 sk P
+	pk := trace1.Copy()
+	pk.Sub(skP.Mul(c1))
+	return pk, nil
+}
+
+func appendTrace(t *Transcript, trace Trace) {
+	t.AppendG1("trace tag", trace.Tag)
+	t.AppendG1("trace commitment", trace.C)
 }
 
 func (p Proof) Bytes() []byte {
@@ -84,47 +242,471 @@ type RawProof struct {
 	Za, Zb []byte
 }
 
+func ProofFromBytes(bytes []byte) (Proof, error) {
+	var rp RawProof
+	rest, err := asn1.Unmarshal(bytes, &rp)
+	if err != nil {
+		return Proof{}, fmt.Errorf("failed unmarshaling tag proof: %v", err)
+	}
+	if len(rest) > 0 {
+		return Proof{}, fmt.Errorf("trailing bytes after tag proof")
+	}
+
+	A, err := G1FromBytes(rp.A)
+	if err != nil {
+		return Proof{}, fmt.Errorf("invalid A: %v", err)
+	}
+	B, err := G1FromBytes(rp.B)
+	if err != nil {
+		return Proof{}, fmt.Errorf("invalid B: %v", err)
+	}
+	a, err := ZrFromBytes(rp.Za)
+	if err != nil {
+		return Proof{}, fmt.Errorf("invalid a: %v", err)
+	}
+	b, err := ZrFromBytes(rp.Zb)
+	if err != nil {
+		return Proof{}, fmt.Errorf("invalid b: %v", err)
+	}
+
+	return Proof{
+		A: A,
+		B: B,
+		a: a,
+		b: b,
+	}, nil
+}
+
+// CheckShape checks that all elements of the proof are present.
+// Unlike Validate, it does not check that they are in their prime order subgroups, which ProofFromBytes already ensures.
+func (p Proof) CheckShape() error {
+	if p.A == nil {
+		return fmt.Errorf("invalid A: missing G1 element")
+	}
+	if p.B == nil {
+		return fmt.Errorf("invalid B: missing G1 element")
+	}
+	if p.a == nil {
+		return fmt.Errorf("invalid a: missing scalar")
+	}
+	if p.b == nil {
+		return fmt.Errorf("invalid b: missing scalar")
+	}
+	return nil
+}
+
+// Validate checks that all elements of the proof are present and in their prime order subgroups.
+func (p Proof) Validate() error {
+	if err := CheckG1(p.A); err != nil {
+		return fmt.Errorf("invalid A: %v", err)
+	}
+	if err := CheckG1(p.B); err != nil {
+		return fmt.Errorf("invalid B: %v", err)
+	}
+	if err := CheckZr(p.a); err != nil {
+		return fmt.Errorf("invalid a: %v", err)
+	}
+	if err := CheckZr(p.b); err != nil {
+		return fmt.Errorf("invalid b: %v", err)
+	}
+	return nil
+}
+
 func (p Proof) Verify(tag *math.G1, com *math.G1, prefix []byte, additionalContext ...[]byte) error {
-	hashInput := buildHashContext(p.A, p.B, additionalContext)
-	c := hashToZr(hashInput...)
-	leftEq := curve.HashToG1(sha256Digest(prefix)).Mul(p.a)
+	return p.VerifyWithTranscript(ContextTranscript(additionalContext...), tag, com, prefix)
+}
 
-	rightEq := tag.Mul(c)
-	rightEq.Add(p.A)
+// VerifyWithTranscript verifies a proof produced by NewProofWithTranscript,
+// given a transcript in the same state as the one given to the prover.
+func (p Proof) VerifyWithTranscript(t *Transcript, tag *math.G1, com *math.G1, prefix []byte) error {
+	return p.PrepareVerification(t, tag, com, prefix).Verify()
+}
+
+// Check holds the equations a tag proof is verified against, once its challenge is derived.
+type Check struct {
+	base, tag, com *math.G1
+	A, B           *math.G1
+	a, b, c        *math.Zr
+	// traceBase is nil unless the proof is traceable
+	traceBase *math.G1
+	trace     Trace
+}
+
+// PrepareVerification derives the challenge of the proof from the transcript,
+// and returns the equations the proof should satisfy.
+func (p Proof) PrepareVerification(t *Transcript, tag *math.G1, com *math.G1, prefix []byte) Check {
+	appendStatement(t, prefix, tag, com)
+	c := challenge(t, p.A, p.B)
+
+	return Check{
+		base: curve.HashToG1(sha256Digest(prefix)),
+		tag:  tag,
+		com:  com,
+		A:    p.A,
+		B:    p.B,
+		a:    p.a,
+		b:    p.b,
+		c:    c,
+	}
+}
+
+func (ch Check) Verify() error {
+	leftEq := ch.base.Mul(ch.a)
+
+	rightEq := ch.tag.Mul(ch.c)
+	rightEq.Add(ch.A)
 
 	if !leftEq.Equals(rightEq) {
 		return fmt.Errorf("tag proof mismatch")
 	}
 
-	leftEq = curve.GenG1.Mul(p.a)
-	leftEq.Add(H().Mul(p.b))
+	leftEq = curve.GenG1.Mul(ch.a)
+	leftEq.Add(H().Mul(ch.b))
 
-	rightEq = p.B.Copy()
-	rightEq.Add(com.Mul(c))
+	rightEq = ch.B.Copy()
+	rightEq.Add(ch.com.Mul(ch.c))
 
 	if !leftEq.Equals(rightEq) {
 		return fmt.Errorf("commitment proof mismatch")
 	}
 
+	if ch.traceBase == nil {
+		return nil
+	}
+
+	leftEq = ch.traceBase.Mul(ch.a)
+
+	rightEq = ch.trace.Tag.Mul(ch.c)
+	rightEq.Add(ch.trace.C)
+
+	if !leftEq.Equals(rightEq) {
+		return fmt.Errorf("trace proof mismatch")
+	}
+
 	return nil
 }
 
-func buildHashContext(A, B *math.G1, additionalContext [][]byte) [][]byte {
-	var hashInput [][]byte
-	hashInput = append(hashInput, A.Bytes(), B.Bytes())
-	for _, ctx := range additionalContext {
-		hashInput = append(hashInput, ctx)
+// BatchVerify verifies many checks at once, by summing all of their equations with random weights.
+// The terms of the generator and of H are accumulated into a single scalar each.
+func BatchVerify(checks []Check) error {
+	sum := curve.NewG1()
+	gCoefficient := curve.NewZrFromInt(0)
+	hCoefficient := curve.NewZrFromInt(0)
+
+	for _, ch := range checks {
+		ρ1, ρ2 := RandomWeight(), RandomWeight()
+
+		// ρ1 * (a * base - c * tag - A)
+		sum.Add(ch.base.Mul(curve.ModMul(ρ1, ch.a, curve.GroupOrder)))
+		sum.Sub(ch.tag.Mul(curve.ModMul(ρ1, ch.c, curve.GroupOrder)))
+		sum.Sub(ch.A.Mul(ρ1))
+
+		// ρ2 * (a * g + b * H - B - c * com)
+		gCoefficient = curve.ModAdd(gCoefficient, curve.ModMul(ρ2, ch.a, curve.GroupOrder), curve.GroupOrder)
+		hCoefficient = curve.ModAdd(hCoefficient, curve.ModMul(ρ2, ch.b, curve.GroupOrder), curve.GroupOrder)
+		sum.Sub(ch.B.Mul(ρ2))
+		sum.Sub(ch.com.Mul(curve.ModMul(ρ2, ch.c, curve.GroupOrder)))
+
+		if ch.traceBase == nil {
+			continue
+		}
+
+		// ρ3 * (a * traceBase - c * trace tag - C)
+		ρ3 := RandomWeight()
+		sum.Add(ch.traceBase.Mul(curve.ModMul(ρ3, ch.a, curve.GroupOrder)))
+		sum.Sub(ch.trace.Tag.Mul(curve.ModMul(ρ3, ch.c, curve.GroupOrder)))
+		sum.Sub(ch.trace.C.Mul(ρ3))
+	}
+
+	sum.Add(curve.GenG1.Mul(gCoefficient))
+	sum.Add(H().Mul(hCoefficient))
+
+	if !sum.IsInfinity() {
+		return fmt.Errorf("batch invalid")
 	}
-	return hashInput
+
+	return nil
 }
 
-func hashToZr(elements ...[]byte) *math.Zr {
-	h := sha256.New()
-	for _, e := range elements {
-		h.Write(e)
+// OpeningProof proves knowledge of the opening of a commitment com = sk g + r H, without a tag.
+type OpeningProof struct {
+	A    *math.G1
+	a, b *math.Zr
+}
+
+type RawOpeningProof struct {
+	A      []byte
+	Za, Zb []byte
+}
+
+// NewOpeningProofWithTranscript proves knowledge of the opening of the commitment of sk,
+// deriving the challenge from the given transcript.
+func NewOpeningProofWithTranscript(t *Transcript, sk *math.Zr, w *Witness) OpeningProof {
+	return NewOpeningProofWithRand(rand.Reader, t, sk, w)
+}
+
+// NewOpeningProofWithRand is NewOpeningProofWithTranscript with randomness read from rnd.
+func NewOpeningProofWithRand(rnd io.Reader, t *Transcript, sk *math.Zr, w *Witness) OpeningProof {
+	π, err := TryNewOpeningProofWithRand(rnd, t, sk, w)
+	if err != nil {
+		panic(err)
 	}
-	digest := h.Sum(nil)
-	return FieldElementFromBytes(digest)
+	return π
+}
+
+// TryNewOpeningProofWithRand is NewOpeningProofWithRand, but returns an error instead of panicking if rnd fails.
+func TryNewOpeningProofWithRand(rnd io.Reader, t *Transcript, sk *math.Zr, w *Witness) (OpeningProof, error) {
+	ar, err := RandomZr(rnd)
+	if err != nil {
+		return OpeningProof{}, err
+	}
+	br, err := RandomZr(rnd)
+	if err != nil {
+		return OpeningProof{}, err
+	}
+
+	com := curve.GenG1.Mul(sk)
+	com.Add(H().Mul(&w.R))
+
+	A := curve.GenG1.Mul(ar)
+	A.Add(H().Mul(br))
+
+	c := openingChallenge(t, com, A)
+
+	a := ar.Plus(sk.Mul(c))
+	a.Mod(curve.GroupOrder)
+	b := br.Plus(w.R.Mul(c))
+	b.Mod(curve.GroupOrder)
+
+	return OpeningProof{
+		A: A,
+		a: a,
+		b: b,
+	}, nil
+}
+
+// CheckShape checks that all elements of the proof are present.
+// Unlike Validate, it does not check that they are in their prime order subgroups, which OpeningProofFromBytes already ensures.
+func (p OpeningProof) CheckShape() error {
+	if p.A == nil {
+		return fmt.Errorf("invalid A: missing G1 element")
+	}
+	if p.a == nil {
+		return fmt.Errorf("invalid a: missing scalar")
+	}
+	if p.b == nil {
+		return fmt.Errorf("invalid b: missing scalar")
+	}
+	return nil
+}
+
+// Validate checks that all elements of the proof are present and in their prime order subgroups.
+func (p OpeningProof) Validate() error {
+	if err := CheckG1(p.A); err != nil {
+		return fmt.Errorf("invalid A: %v", err)
+	}
+	if err := CheckZr(p.a); err != nil {
+		return fmt.Errorf("invalid a: %v", err)
+	}
+	if err := CheckZr(p.b); err != nil {
+		return fmt.Errorf("invalid b: %v", err)
+	}
+	return nil
+}
+
+// VerifyWithTranscript verifies a proof produced by NewOpeningProofWithTranscript,
+// given a transcript in the same state as the one given to the prover.
+func (p OpeningProof) VerifyWithTranscript(t *Transcript, com *math.G1) error {
+	c := openingChallenge(t, com, p.A)
+
+	leftEq := curve.GenG1.Mul(p.a)
+	leftEq.Add(H().Mul(p.b))
+
+	rightEq := com.Mul(c)
+	rightEq.Add(p.A)
+
+	if !leftEq.Equals(rightEq) {
+		return fmt.Errorf("opening proof mismatch")
+	}
+
+	return nil
+}
+
+func (p OpeningProof) Bytes() []byte {
+	bytes, err := asn1.Marshal(RawOpeningProof{
+		A:  p.A.Bytes(),
+		Za: p.a.Bytes(),
+		Zb: p.b.Bytes(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return bytes
+}
+
+func OpeningProofFromBytes(bytes []byte) (OpeningProof, error) {
+	var rp RawOpeningProof
+	rest, err := asn1.Unmarshal(bytes, &rp)
+	if err != nil {
+		return OpeningProof{}, fmt.Errorf("failed unmarshaling opening proof: %v", err)
+	}
+	if len(rest) > 0 {
+		return OpeningProof{}, fmt.Errorf("trailing bytes after opening proof")
+	}
+
+	A, err := G1FromBytes(rp.A)
+	if err != nil {
+		return OpeningProof{}, fmt.Errorf("invalid A: %v", err)
+	}
+	a, err := ZrFromBytes(rp.Za)
+	if err != nil {
+		return OpeningProof{}, fmt.Errorf("invalid a: %v", err)
+	}
+	b, err := ZrFromBytes(rp.Zb)
+	if err != nil {
+		return OpeningProof{}, fmt.Errorf("invalid b: %v", err)
+	}
+
+	return OpeningProof{
+		A: A,
+		a: a,
+		b: b,
+	}, nil
+}
+
+func openingChallenge(t *Transcript, com, A *math.G1) *math.Zr {
+	t.AppendG1("commitment", com)
+	t.AppendG1("A", A)
+	return t.ChallengeZr("c")
+}
+
+// EqualityProof proves that two commitments commit to the same key, without revealing it.
+// Since com1 - com2 = (r1 - r2) H, it is a proof of knowledge of the discrete logarithm of com1 - com2 to the base H.
+type EqualityProof struct {
+	A *math.G1
+	s *math.Zr
+}
+
+type RawEqualityProof struct {
+	A, S []byte
+}
+
+// NewEqualityProof proves that com1 = sk g + r1 H and com2 = sk g + r2 H commit to the same sk.
+func NewEqualityProof(com1, com2 *math.G1, r1, r2 *math.Zr, additionalContext ...[]byte) EqualityProof {
+	return NewEqualityProofWithRand(rand.Reader, com1, com2, r1, r2, additionalContext...)
+}
+
+// NewEqualityProofWithRand is NewEqualityProof with randomness read from rnd.
+func NewEqualityProofWithRand(rnd io.Reader, com1, com2 *math.G1, r1, r2 *math.Zr, additionalContext ...[]byte) EqualityProof {
+	π, err := TryNewEqualityProofWithRand(rnd, com1, com2, r1, r2, additionalContext...)
+	if err != nil {
+		panic(err)
+	}
+	return π
+}
+
+// TryNewEqualityProofWithRand is NewEqualityProofWithRand, but returns an error instead of panicking if rnd fails.
+func TryNewEqualityProofWithRand(rnd io.Reader, com1, com2 *math.G1, r1, r2 *math.Zr, additionalContext ...[]byte) (EqualityProof, error) {
+	k, err := RandomZr(rnd)
+	if err != nil {
+		return EqualityProof{}, err
+	}
+	A := H().Mul(k)
+
+	c := equalityChallenge(ContextTranscript(additionalContext...), com1, com2, A)
+
+	s := curve.ModSub(r1, r2, curve.GroupOrder)
+	s = s.Mul(c)
+	s.Mod(curve.GroupOrder)
+	s = s.Plus(k)
+	s.Mod(curve.GroupOrder)
+
+	return EqualityProof{
+		A: A,
+		s: s,
+	}, nil
+}
+
+func (p EqualityProof) Verify(com1, com2 *math.G1, additionalContext ...[]byte) error {
+	c := equalityChallenge(ContextTranscript(additionalContext...), com1, com2, p.A)
+
+	d := com1.Copy()
+	d.Sub(com2)
+
+	rightEq := d.Mul(c)
+	rightEq.Add(p.A)
+
+	if !H().Mul(p.s).Equals(rightEq) {
+		return fmt.Errorf("equality proof mismatch")
+	}
+
+	return nil
+}
+
+func (p EqualityProof) Bytes() []byte {
+	bytes, err := asn1.Marshal(RawEqualityProof{
+		A: p.A.Bytes(),
+		S: p.s.Bytes(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return bytes
+}
+
+func EqualityProofFromBytes(bytes []byte) (EqualityProof, error) {
+	var rp RawEqualityProof
+	rest, err := asn1.Unmarshal(bytes, &rp)
+	if err != nil {
+		return EqualityProof{}, fmt.Errorf("failed unmarshaling equality proof: %v", err)
+	}
+	if len(rest) > 0 {
+		return EqualityProof{}, fmt.Errorf("trailing bytes after equality proof")
+	}
+
+	A, err := G1FromBytes(rp.A)
+	if err != nil {
+		return EqualityProof{}, fmt.Errorf("invalid A: %v", err)
+	}
+	s, err := ZrFromBytes(rp.S)
+	if err != nil {
+		return EqualityProof{}, fmt.Errorf("invalid s: %v", err)
+	}
+
+	return EqualityProof{
+		A: A,
+		s: s,
+	}, nil
+}
+
+func equalityChallenge(t *Transcript, com1, com2, A *math.G1) *math.Zr {
+	t.AppendBytes("statement", []byte("equality"))
+	t.AppendG1("first commitment", com1)
+	t.AppendG1("second commitment", com2)
+	t.AppendG1("A", A)
+	return t.ChallengeZr("c")
+}
+
+// ContextTranscript returns the transcript that NewProof and Verify derive the challenge from,
+// given the same additional context. NewProofWithRand makes the proof NewProof does when given it.
+func ContextTranscript(additionalContext ...[]byte) *Transcript {
+	t := NewTranscript(TagProofLabel)
+	for _, ctx := range additionalContext {
+		t.AppendBytes("context", ctx)
+	}
+	return t
+}
+
+func appendStatement(t *Transcript, prefix []byte, tag, com *math.G1) {
+	t.AppendBytes("prefix", prefix)
+	t.AppendG1("tag", tag)
+	t.AppendG1("commitment", com)
+}
+
+func challenge(t *Transcript, A, B *math.G1) *math.Zr {
+	t.AppendG1("A", A)
+	t.AppendG1("B", B)
+	return t.ChallengeZr("c")
 }
 
 func sha256Digest(in []byte) []byte {
@@ -8,6 +8,8 @@ package tag
 
 import (
 	"crypto/rand"
+	"io"
+	mrand "math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -28,3 +30,101 @@ func TestTagProof(t *testing.T) {
 	err = proof.Verify(tag, com, []byte{3, 2, 1})
 	assert.EqualError(t, err, "tag proof mismatch")
 }
+
+func TestBatchVerify(t *testing.T) {
+	prefix := []byte{1, 2, 3}
+
+	var checks []Check
+	for i := 0; i < 4; i++ {
+		sk := curve.NewRandomZr(rand.Reader)
+		w, com := Commit(sk)
+		π := NewProof(prefix, sk, w)
+		checks = append(checks, π.PrepareVerification(ContextTranscript(), Tag(sk, prefix), com, prefix))
+	}
+
+	assert.NoError(t, BatchVerify(checks))
+	assert.NoError(t, BatchVerify(nil))
+
+	checks[2].tag = checks[1].tag
+	assert.EqualError(t, BatchVerify(checks), "batch invalid")
+	assert.Error(t, checks[2].Verify())
+}
+
+func TestTraceableProof(t *testing.T) {
+	sk := curve.NewRandomZr(rand.Reader)
+	w, com := Commit(sk)
+	prefix := []byte{1, 2, 3}
+
+	π1, trace1 := NewTraceableProofWithTranscript(ContextTranscript(), prefix, []byte("m1"), sk, w)
+	ch := π1.PrepareTraceableVerification(ContextTranscript(), Tag(sk, prefix), com, prefix, []byte("m1"), trace1)
+	assert.NoError(t, ch.Verify())
+	assert.NoError(t, BatchVerify([]Check{ch}))
+
+	ch = π1.PrepareTraceableVerification(ContextTranscript(), Tag(sk, prefix), com, prefix, []byte("m2"), trace1)
+	assert.EqualError(t, ch.Verify(), "trace proof mismatch")
+	assert.EqualError(t, BatchVerify([]Check{ch}), "batch invalid")
+
+	// Without the trace, the proof does not verify
+	assert.Error(t, π1.Verify(Tag(sk, prefix), com, prefix))
+
+	_, trace2 := NewTraceableProofWithTranscript(ContextTranscript(), prefix, []byte("m2"), sk, w)
+	pk, err := TracePublicKey(prefix, []byte("m1"), trace1.Tag, []byte("m2"), trace2.Tag)
+	assert.NoError(t, err)
+	assert.True(t, pk.Equals(curve.GenG1.Mul(sk)))
+
+	_, err = TracePublicKey(prefix, []byte("m1"), trace1.Tag, []byte("m1"), trace1.Tag)
+	assert.EqualError(t, err, "messages are identical")
+}
+
+func TestEqualityProof(t *testing.T) {
+	sk := curve.NewRandomZr(rand.Reader)
+	w1, com1 := Commit(sk)
+	w2, com2 := Commit(sk)
+	_, com3 := Commit(curve.NewRandomZr(rand.Reader))
+
+	π := NewEqualityProof(com1, com2, &w1.R, &w2.R, []byte("context"))
+	assert.NoError(t, π.Verify(com1, com2, []byte("context")))
+	assert.EqualError(t, π.Verify(com1, com2), "equality proof mismatch")
+	assert.EqualError(t, π.Verify(com1, com3, []byte("context")), "equality proof mismatch")
+
+	loaded, err := EqualityProofFromBytes(π.Bytes())
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.Verify(com1, com2, []byte("context")))
+}
+
+func TestOpeningProof(t *testing.T) {
+	sk := curve.NewRandomZr(rand.Reader)
+	w, com := Commit(sk)
+	_, other := Commit(sk)
+
+	π := NewOpeningProofWithTranscript(ContextTranscript(), sk, w)
+	assert.NoError(t, π.VerifyWithTranscript(ContextTranscript(), com))
+	assert.EqualError(t, π.VerifyWithTranscript(ContextTranscript(), other), "opening proof mismatch")
+
+	loaded, err := OpeningProofFromBytes(π.Bytes())
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.VerifyWithTranscript(ContextTranscript(), com))
+}
+
+func TestCommitWithRand(t *testing.T) {
+	sk := curve.NewZrFromInt(42)
+
+	w1, com1 := CommitWithRand(mrand.New(mrand.NewSource(1)), sk)
+	w2, com2 := CommitWithRand(mrand.New(mrand.NewSource(1)), sk)
+	assert.True(t, w1.R.Equals(&w2.R))
+	assert.True(t, com1.Equals(com2))
+
+	prefix := []byte{1, 2, 3}
+	π1 := NewProofWithRand(mrand.New(mrand.NewSource(2)), ContextTranscript(), prefix, sk, w1)
+	π2 := NewProofWithRand(mrand.New(mrand.NewSource(2)), ContextTranscript(), prefix, sk, w1)
+	assert.Equal(t, π1.Bytes(), π2.Bytes())
+	assert.NoError(t, π1.Verify(Tag(sk, prefix), com1, prefix))
+
+	// A source of randomness that runs dry fails the proofs instead of panicking
+	_, _, err := TryNewTraceableProofWithRand(io.LimitReader(rand.Reader, 100), ContextTranscript(), prefix, []byte("m"), sk, w1)
+	assert.EqualError(t, err, "failed reading randomness: unexpected EOF")
+	_, err = TryNewOpeningProofWithRand(io.LimitReader(rand.Reader, 100), ContextTranscript(), sk, w1)
+	assert.EqualError(t, err, "failed reading randomness: unexpected EOF")
+	_, err = TryNewEqualityProofWithRand(io.LimitReader(rand.Reader, 10), com1, com2, &w1.R, &w2.R)
+	assert.EqualError(t, err, "failed reading randomness: unexpected EOF")
+}
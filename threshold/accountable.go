@@ -0,0 +1,422 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"crypto/rand"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	. "privacy-perserving-audit/common"
+	"privacy-perserving-audit/tag"
+
+	math "github.com/IBM/mathlib"
+)
+
+// OpenerPublicKey is the ElGamal key accountable signatures encrypt the public key of their signer under.
+type OpenerPublicKey math.G1
+
+type OpenerPrivateKey math.Zr
+
+func OpenerKeyGen() (OpenerPublicKey, OpenerPrivateKey) {
+	return OpenerKeyGenFrom(rand.Reader)
+}
+
+// OpenerKeyGenFrom is OpenerKeyGen with randomness read from rnd.
+func OpenerKeyGenFrom(rnd io.Reader) (OpenerPublicKey, OpenerPrivateKey) {
+	pk, sk, err := TryOpenerKeyGenFrom(rnd)
+	if err != nil {
+		panic(err)
+	}
+	return pk, sk
+}
+
+// TryOpenerKeyGenFrom is OpenerKeyGenFrom, but returns an error instead of panicking if rnd fails.
+func TryOpenerKeyGenFrom(rnd io.Reader) (OpenerPublicKey, OpenerPrivateKey, error) {
+	sk, err := RandomZr(rnd)
+	if err != nil {
+		return OpenerPublicKey{}, OpenerPrivateKey{}, err
+	}
+	return OpenerPublicKey(*curve.GenG1.Mul(sk)), OpenerPrivateKey(*sk), nil
+}
+
+// Escrow is the ElGamal encryption (E1, E2) = (ρ g, pk + ρ O) of the public key of the signer under the key O of an opener,
+// along with a proof that it encrypts the key committed to in the tag commitment of the signature.
+type Escrow struct {
+	Opener *math.G1
+	E1, E2 *math.G1
+	proof  escrowProof
+}
+
+// escrowProof proves knowledge of sk, r and ρ such that com = sk g + r H, E1 = ρ g and E2 = sk g + ρ O.
+type escrowProof struct {
+	A, B, C *math.G1
+	a, b, d *math.Zr
+}
+
+type RawEscrow struct {
+	Opener, E1, E2 []byte
+	A, B, C        []byte
+	Za, Zb, Zd     []byte
+}
+
+func (esc Escrow) Bytes() []byte {
+	bytes, err := asn1.Marshal(RawEscrow{
+		Opener: esc.Opener.Bytes(),
+		E1:     esc.E1.Bytes(),
+		E2:     esc.E2.Bytes(),
+		A:      esc.proof.A.Bytes(),
+		B:      esc.proof.B.Bytes(),
+		C:      esc.proof.C.Bytes(),
+		Za:     esc.proof.a.Bytes(),
+		Zb:     esc.proof.b.Bytes(),
+		Zd:     esc.proof.d.Bytes(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return bytes
+}
+
+func EscrowFromBytes(serialized []byte) (Escrow, error) {
+	var raw RawEscrow
+	rest, err := asn1.Unmarshal(serialized, &raw)
+	if err != nil {
+		return Escrow{}, fmt.Errorf("failed unmarshaling escrow: %v", err)
+	}
+	if len(rest) > 0 {
+		return Escrow{}, fmt.Errorf("trailing bytes after escrow")
+	}
+
+	var esc Escrow
+	points := []struct {
+		p   **math.G1
+		raw []byte
+	}{
+		{&esc.Opener, raw.Opener}, {&esc.E1, raw.E1}, {&esc.E2, raw.E2},
+		{&esc.proof.A, raw.A}, {&esc.proof.B, raw.B}, {&esc.proof.C, raw.C},
+	}
+	for _, point := range points {
+		if *point.p, err = G1FromBytes(point.raw); err != nil {
+			return Escrow{}, fmt.Errorf("invalid escrow: %v", err)
+		}
+	}
+
+	scalars := []struct {
+		x   **math.Zr
+		raw []byte
+	}{
+		{&esc.proof.a, raw.Za}, {&esc.proof.b, raw.Zb}, {&esc.proof.d, raw.Zd},
+	}
+	for _, scalar := range scalars {
+		if *scalar.x, err = ZrFromBytes(scalar.raw); err != nil {
+			return Escrow{}, fmt.Errorf("invalid escrow: %v", err)
+		}
+	}
+
+	return esc, nil
+}
+
+// SignAccountable signs like Sign, but the signature also escrows the public key of the signer to the opener.
+func (key PrivateKey) SignAccountable(pp PublicParams, m []byte, prefix []byte, ring Ring, opener OpenerPublicKey) RingSignature {
+	return key.SignAccountableWithRand(rand.Reader, pp, m, prefix, ring, opener)
+}
+
+// SignAccountableWithRand is SignAccountable with randomness read from rnd.
+func (key PrivateKey) SignAccountableWithRand(rnd io.Reader, pp PublicParams, m []byte, prefix []byte, ring Ring, opener OpenerPublicKey) RingSignature {
+	σ, err := key.TrySignAccountableWithRand(rnd, pp, m, prefix, ring, opener)
+	if err != nil {
+		panic(err)
+	}
+	return σ
+}
+
+// TrySignAccountableWithRand is SignAccountableWithRand, but returns an error instead of panicking if the key is not in the ring,
+// the ring or the public parameters are malformed, or rnd fails.
+func (key PrivateKey) TrySignAccountableWithRand(rnd io.Reader, pp PublicParams, m []byte, prefix []byte, ring Ring, opener OpenerPublicKey) (RingSignature, error) {
+	sk := math.Zr(key)
+	r, com, err := tag.TryCommitWithRand(rnd, &sk)
+	if err != nil {
+		return RingSignature{}, err
+	}
+
+	σ, err := key.tryRingProof(rnd, pp, ring, &r.R, com)
+	if err != nil {
+		return RingSignature{}, err
+	}
+
+	O := math.G1(opener)
+	esc, err := newEscrow(rnd, escrowTranscript(σ.transcript), &O, &sk, &r.R, com)
+	if err != nil {
+		return RingSignature{}, err
+	}
+	σ.Escrow = &esc
+
+	πt, err := tag.TryNewProofWithRand(rnd, tagTranscript(σ.transcript, m), prefix, &sk, r)
+	if err != nil {
+		return RingSignature{}, err
+	}
+
+	σ.TagValue = tag.Tag(&sk, prefix)
+	σ.TagProof = πt
+
+	return σ, nil
+}
+
+func newEscrow(rnd io.Reader, t *Transcript, O *math.G1, sk, r *math.Zr, com *math.G1) (Escrow, error) {
+	nonces := make([]*math.Zr, 4)
+	for i := range nonces {
+		var err error
+		if nonces[i], err = RandomZr(rnd); err != nil {
+			return Escrow{}, err
+		}
+	}
+	ρ, ar, br, dr := nonces[0], nonces[1], nonces[2], nonces[3]
+
+	esc := Escrow{
+		Opener: O,
+		E1:     curve.GenG1.Mul(ρ),
+		E2:     curve.GenG1.Mul(sk),
+	}
+	esc.E2.Add(O.Mul(ρ))
+
+	esc.proof.A = curve.GenG1.Mul(ar)
+	esc.proof.A.Add(H().Mul(br))
+	esc.proof.B = curve.GenG1.Mul(dr)
+	esc.proof.C = curve.GenG1.Mul(ar)
+	esc.proof.C.Add(O.Mul(dr))
+
+	c := esc.challenge(t, com)
+
+	esc.proof.a = mulAddZr(ar, c, sk)
+	esc.proof.b = mulAddZr(br, c, r)
+	esc.proof.d = mulAddZr(dr, c, ρ)
+
+	return esc, nil
+}
+
+// checkShape checks that all elements of the escrow are present.
+func (esc Escrow) checkShape() error {
+	for _, g := range []*math.G1{esc.Opener, esc.E1, esc.E2, esc.proof.A, esc.proof.B, esc.proof.C} {
+		if g == nil {
+			return fmt.Errorf("missing G1 element")
+		}
+	}
+	for _, x := range []*math.Zr{esc.proof.a, esc.proof.b, esc.proof.d} {
+		if x == nil {
+			return fmt.Errorf("missing scalar")
+		}
+	}
+	return nil
+}
+
+func (esc Escrow) validate() error {
+	for _, g := range []*math.G1{esc.Opener, esc.E1, esc.E2, esc.proof.A, esc.proof.B, esc.proof.C} {
+		if err := CheckG1(g); err != nil {
+			return err
+		}
+	}
+	for _, x := range []*math.Zr{esc.proof.a, esc.proof.b, esc.proof.d} {
+		if err := CheckZr(x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verify verifies the proof of the escrow given the transcript of the signature and its tag commitment.
+func (esc Escrow) verify(t *Transcript, com *math.G1) error {
+	c := esc.challenge(t, com)
+	π := esc.proof
+
+	// a g + b H = A + c com
+	left := curve.GenG1.Mul(π.a)
+	left.Add(H().Mul(π.b))
+	right := com.Mul(c)
+	right.Add(π.A)
+	if !left.Equals(right) {
+		return fmt.Errorf("escrow proof invalid")
+	}
+
+	// d g = B + c E1
+	left = curve.GenG1.Mul(π.d)
+	right = esc.E1.Mul(c)
+	right.Add(π.B)
+	if !left.Equals(right) {
+		return fmt.Errorf("escrow proof invalid")
+	}
+
+	// a g + d O = C + c E2
+	left = curve.GenG1.Mul(π.a)
+	left.Add(esc.Opener.Mul(π.d))
+	right = esc.E2.Mul(c)
+	right.Add(π.C)
+	if !left.Equals(right) {
+		return fmt.Errorf("escrow proof invalid")
+	}
+
+	return nil
+}
+
+func (esc Escrow) challenge(t *Transcript, com *math.G1) *math.Zr {
+	t.AppendG1("commitment", com)
+	t.AppendG1("opener", esc.Opener)
+	t.AppendG1("E1", esc.E1)
+	t.AppendG1("E2", esc.E2)
+	t.AppendG1("A", esc.proof.A)
+	t.AppendG1("B", esc.proof.B)
+	t.AppendG1("C", esc.proof.C)
+	return t.ChallengeZr("c")
+}
+
+// escrowTranscript forks the transcript of the signature after its ring proofs, so that the escrow is bound to them.
+func escrowTranscript(t *Transcript) *Transcript {
+	return t.Fork("escrow")
+}
+
+// mulAddZr returns x + y z.
+func mulAddZr(x, y, z *math.Zr) *math.Zr {
+	res := y.Mul(z)
+	res.Mod(curve.GroupOrder)
+	res = res.Plus(x)
+	res.Mod(curve.GroupOrder)
+	return res
+}
+
+// VerifyAccountable verifies the signature, and that it escrows the public key of its signer to the given opener.
+func (rs RingSignature) VerifyAccountable(pp PublicParams, m, prefix []byte, opener OpenerPublicKey) error {
+	if err := rs.escrowedTo(opener); err != nil {
+		return err
+	}
+
+	return rs.Verify(pp, m, prefix)
+}
+
+// OpeningProof proves that the opener decrypted the escrow of a signature correctly,
+// i.e. that log_g O = log_E1 (E2 - pk).
+type OpeningProof struct {
+	A1, A2 *math.G1
+	S      *math.Zr
+}
+
+// escrowedTo checks that the signature carries a well formed escrow to the opener.
+func (rs RingSignature) escrowedTo(opener OpenerPublicKey) error {
+	if rs.Escrow == nil {
+		return fmt.Errorf("signature is not accountable to the opener")
+	}
+
+	if err := rs.Escrow.checkShape(); err != nil {
+		return fmt.Errorf("malformed signature: invalid escrow: %v", err)
+	}
+
+	O := math.G1(opener)
+	if !rs.Escrow.Opener.Equals(&O) {
+		return fmt.Errorf("signature is not accountable to the opener")
+	}
+
+	return nil
+}
+
+// Open decrypts the escrow of an accountable signature, and returns the index of its signer in the ring
+// along with a proof of the decryption. The signature is assumed to be verified.
+// The escrow decrypts to the public key of the signer, and a signature does not carry its ring,
+// hence the ring is needed to turn the public key into the index of the signer.
+func Open(opener OpenerPrivateKey, ring Ring, σ RingSignature) (int, OpeningProof, error) {
+	return OpenWithRand(rand.Reader, opener, ring, σ)
+}
+
+// OpenWithRand is Open with randomness read from rnd.
+func OpenWithRand(rnd io.Reader, opener OpenerPrivateKey, ring Ring, σ RingSignature) (int, OpeningProof, error) {
+	x := math.Zr(opener)
+	O := curve.GenG1.Mul(&x)
+
+	if err := σ.escrowedTo(OpenerPublicKey(*O)); err != nil {
+		return 0, OpeningProof{}, err
+	}
+
+	pk := σ.Escrow.E2.Copy()
+	pk.Sub(σ.Escrow.E1.Mul(&x))
+
+	index := -1
+	for i := range ring {
+		if ring[i] != nil && ring[i].Equals(pk) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return 0, OpeningProof{}, fmt.Errorf("opened public key is not in the ring")
+	}
+
+	k, err := RandomZr(rnd)
+	if err != nil {
+		return 0, OpeningProof{}, err
+	}
+	π := OpeningProof{
+		A1: curve.GenG1.Mul(k),
+		A2: σ.Escrow.E1.Mul(k),
+	}
+	c := π.challenge(*σ.Escrow, pk)
+	π.S = mulAddZr(k, c, &x)
+
+	return index, π, nil
+}
+
+// VerifyOpening verifies that the signer at the given index of the ring is the one the escrow of the signature encrypts.
+func VerifyOpening(opener OpenerPublicKey, ring Ring, σ RingSignature, index int, π OpeningProof) error {
+	O := math.G1(opener)
+
+	if err := σ.escrowedTo(opener); err != nil {
+		return err
+	}
+
+	if index < 0 || index >= len(ring) {
+		return fmt.Errorf("index %d out of range for a ring of size %d", index, len(ring))
+	}
+
+	if ring[index] == nil {
+		return fmt.Errorf("ring member %d is missing", index)
+	}
+
+	if π.A1 == nil || π.A2 == nil || π.S == nil {
+		return fmt.Errorf("malformed opening proof")
+	}
+
+	pk := ring[index]
+	c := π.challenge(*σ.Escrow, pk)
+
+	// S g = A1 + c O
+	left := curve.GenG1.Mul(π.S)
+	right := O.Mul(c)
+	right.Add(π.A1)
+	if !left.Equals(right) {
+		return fmt.Errorf("opening proof invalid")
+	}
+
+	// S E1 = A2 + c (E2 - pk)
+	left = σ.Escrow.E1.Mul(π.S)
+	right = σ.Escrow.E2.Copy()
+	right.Sub(pk)
+	right = right.Mul(c)
+	right.Add(π.A2)
+	if !left.Equals(right) {
+		return fmt.Errorf("opening proof invalid")
+	}
+
+	return nil
+}
+
+func (π OpeningProof) challenge(esc Escrow, pk *math.G1) *math.Zr {
+	t := NewTranscript(OpeningLabel)
+	t.AppendG1("opener", esc.Opener)
+	t.AppendG1("E1", esc.E1)
+	t.AppendG1("E2", esc.E2)
+	t.AppendG1("public key", pk)
+	t.AppendG1("A1", π.A1)
+	t.AppendG1("A2", π.A2)
+	return t.ChallengeZr("c")
+}
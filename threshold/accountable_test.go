@@ -0,0 +1,94 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"privacy-perserving-audit/common"
+	"testing"
+
+	math "github.com/IBM/mathlib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpen(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 4)
+
+	openerPK, openerSK := OpenerKeyGen()
+	otherPK, otherSK := OpenerKeyGen()
+
+	σ := sks[3].SignAccountable(pp, msg, prefix, ring, openerPK)
+	assert.NoError(t, σ.VerifyAccountable(pp, msg, prefix, openerPK))
+	assert.NoError(t, VerifyBatch(pp, msg, prefix, σ, sks[0].Sign(pp, msg, prefix, ring)))
+	assert.EqualError(t, σ.VerifyAccountable(pp, msg, prefix, otherPK), "signature is not accountable to the opener")
+	assert.EqualError(t, sks[3].Sign(pp, msg, prefix, ring).VerifyAccountable(pp, msg, prefix, openerPK), "signature is not accountable to the opener")
+
+	loaded, err := SignatureFromBytes(σ.Bytes())
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.VerifyAccountable(pp, msg, prefix, openerPK))
+
+	index, π, err := Open(openerSK, ring, loaded)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, index)
+	assert.NoError(t, VerifyOpening(openerPK, ring, σ, index, π))
+	assert.EqualError(t, VerifyOpening(openerPK, ring, σ, 1, π), "opening proof invalid")
+	assert.EqualError(t, VerifyOpening(openerPK, ring, σ, 4, π), "index 4 out of range for a ring of size 4")
+
+	_, _, err = Open(otherSK, ring, σ)
+	assert.EqualError(t, err, "signature is not accountable to the opener")
+
+	// The escrow of another signer cannot be swapped in
+	tampered := σ
+	other := sks[1].SignAccountable(pp, msg, prefix, ring, openerPK)
+	tampered.Escrow = other.Escrow
+	assert.EqualError(t, tampered.Verify(pp, msg, prefix), "escrow proof invalid")
+
+	var batchErr *BatchVerificationError
+	assert.ErrorAs(t, VerifyBatch(pp, msg, prefix, other, tampered), &batchErr)
+	assert.Equal(t, []int{1}, batchErr.Invalid)
+
+	// A hand built escrow is rejected instead of panicking
+	tampered.Escrow = &Escrow{}
+	assert.EqualError(t, tampered.VerifyAccountable(pp, msg, prefix, openerPK), "malformed signature: invalid escrow: missing G1 element")
+	assert.EqualError(t, VerifyOpening(openerPK, ring, tampered, index, π), "malformed signature: invalid escrow: missing G1 element")
+	_, _, err = Open(openerSK, ring, tampered)
+	assert.EqualError(t, err, "malformed signature: invalid escrow: missing G1 element")
+
+	assert.EqualError(t, VerifyOpening(openerPK, ring, σ, index, OpeningProof{}), "malformed opening proof")
+	assert.EqualError(t, VerifyOpening(openerPK, Ring{ring[0], ring[1], ring[2], nil}, σ, index, π), "ring member 3 is missing")
+}
+
+func TestTrySignAccountable(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 2)
+	_, outsider := KeyGen()
+
+	_, _, err := TryOpenerKeyGenFrom(io.LimitReader(rand.Reader, 10))
+	assert.EqualError(t, err, "failed reading randomness: unexpected EOF")
+
+	openerPK, openerSK := OpenerKeyGen()
+
+	_, err = outsider.TrySignAccountableWithRand(rand.Reader, pp, msg, prefix, ring, openerPK)
+	assert.True(t, errors.Is(err, ErrNotInRing))
+
+	for _, n := range []int64{10, 100, 300} {
+		_, err = sks[0].TrySignAccountableWithRand(io.LimitReader(rand.Reader, n), pp, msg, prefix, ring, openerPK)
+		assert.EqualError(t, err, "failed reading randomness: unexpected EOF")
+	}
+
+	sk := math.Zr(sks[0])
+	_, err = newEscrow(io.LimitReader(rand.Reader, 200), common.NewTranscript(common.RingSignatureLabel), ring[1], &sk, &sk, ring[0])
+	assert.EqualError(t, err, "failed reading randomness: unexpected EOF")
+
+	σ, err := sks[0].TrySignAccountableWithRand(rand.Reader, pp, msg, prefix, ring, openerPK)
+	assert.NoError(t, err)
+	assert.NoError(t, σ.VerifyAccountable(pp, msg, prefix, openerPK))
+
+	_, _, err = OpenWithRand(io.LimitReader(rand.Reader, 10), openerSK, ring, σ)
+	assert.EqualError(t, err, "failed reading randomness: unexpected EOF")
+}
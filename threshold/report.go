@@ -0,0 +1,167 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrUnverified is returned for a signature whose verification was cancelled before all checks were made.
+var ErrUnverified = errors.New("signature was not verified")
+
+// SignatureReport is the result of every check a signature is verified against.
+// A nil error means the check passed.
+type SignatureReport struct {
+	// Verified is false if the verification was cancelled before all checks were made,
+	// in which case the checks that were not made are nil
+	Verified bool
+	// Malformed is the result of Validate. If it is not nil, no other check is made.
+	Malformed  error
+	DoryProof1 error
+	DoryProof2 error
+	TagProof   error
+	// Escrow is the result of verifying the escrow of an accountable signature
+	Escrow error
+	// Duplicate is not nil if another signature of the set carries the same tag
+	Duplicate error
+}
+
+// Err returns the first check that failed, or ErrUnverified if none failed but not all were made,
+// or nil if all passed.
+func (sr SignatureReport) Err() error {
+	for _, err := range []error{sr.Malformed, sr.DoryProof1, sr.DoryProof2, sr.TagProof, sr.Escrow, sr.Duplicate} {
+		if err != nil {
+			return err
+		}
+	}
+	if !sr.Verified {
+		return ErrUnverified
+	}
+	return nil
+}
+
+// VerificationReport is the result of verifying a set of signatures.
+type VerificationReport struct {
+	Signatures []SignatureReport
+	// Linked is not nil if some of the signatures were made by the same signer
+	Linked *LinkedSignaturesError
+}
+
+// Invalid returns the indices of the signatures that failed a check or were not verified, in increasing order.
+func (r VerificationReport) Invalid() []int {
+	var invalid []int
+	for i, sr := range r.Signatures {
+		if sr.Err() != nil {
+			invalid = append(invalid, i)
+		}
+	}
+	return invalid
+}
+
+// Err returns nil if all signatures are valid and were made by distinct signers.
+// Otherwise, it returns the LinkedSignaturesError if there is one,
+// and else the error of the lowest indexed invalid signature.
+func (r VerificationReport) Err() error {
+	if r.Linked != nil {
+		return r.Linked
+	}
+	for i, sr := range r.Signatures {
+		if err := sr.Err(); err != nil {
+			return fmt.Errorf("signature %d is invalid: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// VerifyThresholdSignaturesWithContext verifies the signatures like VerifyThresholdSignatures,
+// but makes all checks of all signatures and reports the result of each one.
+// If ctx is done before all signatures are verified, it stops and returns the report so far along with the error of ctx.
+func VerifyThresholdSignaturesWithContext(ctx context.Context, pp PublicParams, msg, prefix []byte, signatures ...RingSignature) (VerificationReport, error) {
+	return verifyWithContext(ctx, pp, msg, prefix, false, signatures...)
+}
+
+func verifyWithContext(ctx context.Context, pp PublicParams, msg, prefix []byte, weighted bool, signatures ...RingSignature) (VerificationReport, error) {
+	report := VerificationReport{
+		Signatures: make([]SignatureReport, len(signatures)),
+		Linked:     checkLinked(tagsOf(signatures)),
+	}
+
+	tasks := make([]func(), len(signatures))
+	for i := range signatures {
+		i := i
+		tasks[i] = func() {
+			report.Signatures[i] = signatures[i].report(ctx, pp, msg, prefix, weighted)
+		}
+	}
+
+	executorOf(pp.DoryParams).Parallel(tasks...)
+
+	if report.Linked != nil {
+		for _, indices := range report.Linked.Linked {
+			for _, i := range indices {
+				report.Signatures[i].Duplicate = fmt.Errorf("signatures %v carry the same tag", indices)
+			}
+		}
+	}
+
+	return report, ctx.Err()
+}
+
+// Report verifies the signature like Verify, but makes all checks and reports the result of each one.
+func (rs RingSignature) Report(pp PublicParams, m, prefix []byte) SignatureReport {
+	return rs.report(context.Background(), pp, m, prefix, false)
+}
+
+func (rs RingSignature) report(ctx context.Context, pp PublicParams, m, prefix []byte, weighted bool) SignatureReport {
+	var sr SignatureReport
+
+	if ctx.Err() != nil {
+		return sr
+	}
+
+	checks := rs.prepareVerification(pp, m, prefix, weighted)
+	if checks.malformed != nil {
+		sr.Malformed = checks.malformed
+		sr.Verified = true
+		return sr
+	}
+
+	if ctx.Err() != nil {
+		return sr
+	}
+
+	sr.Escrow = rs.verifyEscrow(checks.transcript)
+
+	if ctx.Err() != nil {
+		return sr
+	}
+
+	if err := checks.ringProof.Verify(); err != nil {
+		sr.DoryProof1 = fmt.Errorf("first Dory proof invalid")
+	}
+
+	if ctx.Err() != nil {
+		return sr
+	}
+
+	if err := checks.sumProof.Verify(); err != nil {
+		sr.DoryProof2 = fmt.Errorf("second Dory proof invalid")
+	}
+
+	if ctx.Err() != nil {
+		return sr
+	}
+
+	if err := checks.tagProof.Verify(); err != nil {
+		sr.TagProof = fmt.Errorf("tag proof invalid")
+	}
+
+	sr.Verified = true
+	return sr
+}
@@ -0,0 +1,112 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerificationReport(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 4)
+
+	var signatures []RingSignature
+	for _, sk := range sks {
+		signatures = append(signatures, sk.Sign(pp, msg, prefix, ring))
+	}
+
+	report, err := VerifyThresholdSignaturesWithContext(context.Background(), pp, msg, prefix, signatures...)
+	assert.NoError(t, err)
+	assert.NoError(t, report.Err())
+	assert.Empty(t, report.Invalid())
+	for _, sr := range report.Signatures {
+		assert.True(t, sr.Verified)
+	}
+
+	signatures[1].Z = signatures[0].Z
+	signatures[1].DoryProof2 = signatures[0].DoryProof2
+	signatures[2].TagProof = signatures[3].TagProof
+	signatures[3].B = nil
+	signatures = append(signatures, signatures[0])
+
+	report, err = VerifyThresholdSignaturesWithContext(context.Background(), pp, msg, prefix, signatures...)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, report.Invalid())
+	assert.Equal(t, [][]int{{0, 4}}, report.Linked.Linked)
+
+	assert.NoError(t, report.Signatures[0].Malformed)
+	assert.NoError(t, report.Signatures[0].DoryProof1)
+	assert.EqualError(t, report.Signatures[0].Duplicate, "signatures [0 4] carry the same tag")
+
+	assert.EqualError(t, report.Signatures[1].TagProof, "tag proof invalid")
+	assert.EqualError(t, report.Signatures[1].DoryProof1, "first Dory proof invalid")
+	assert.EqualError(t, report.Signatures[1].DoryProof2, "second Dory proof invalid")
+
+	assert.NoError(t, report.Signatures[2].DoryProof1)
+	assert.NoError(t, report.Signatures[2].DoryProof2)
+	assert.EqualError(t, report.Signatures[2].TagProof, "tag proof invalid")
+
+	assert.EqualError(t, report.Signatures[3].Malformed, "malformed signature: invalid B: missing Gt element")
+
+	var linkedErr *LinkedSignaturesError
+	assert.True(t, errors.As(report.Err(), &linkedErr))
+
+	report.Linked = nil
+	assert.EqualError(t, report.Err(), "signature 0 is invalid: signatures [0 4] carry the same tag")
+
+	// A cancelled verification verifies nothing, hence no signature counts as valid
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report, err = VerifyThresholdSignaturesWithContext(ctx, pp, msg, prefix, signatures[:4]...)
+	assert.Equal(t, context.Canceled, err)
+	for _, sr := range report.Signatures {
+		assert.False(t, sr.Verified)
+		assert.True(t, errors.Is(sr.Err(), ErrUnverified))
+	}
+	assert.Equal(t, []int{0, 1, 2, 3}, report.Invalid())
+	assert.EqualError(t, report.Err(), "signature 0 is invalid: signature was not verified")
+}
+
+// cancelAfter is a context that is cancelled once Err is called more than n times.
+type cancelAfter struct {
+	context.Context
+	n int32
+}
+
+func (ctx *cancelAfter) Err() error {
+	if atomic.AddInt32(&ctx.n, -1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestReportCancelledBetweenSubProofs(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 2)
+	openerPK, _ := OpenerKeyGen()
+
+	σ := sks[0].SignAccountable(pp, msg, prefix, ring, openerPK)
+	σ.Escrow = sks[1].SignAccountable(pp, msg, prefix, ring, openerPK).Escrow
+	σ.TagProof = sks[1].Sign(pp, msg, prefix, ring).TagProof
+
+	// The context is checked before the escrow, and before each of the Dory proofs and the tag proof
+	for n := int32(0); n < 5; n++ {
+		sr := σ.report(&cancelAfter{Context: context.Background(), n: n}, pp, msg, prefix, false)
+		assert.False(t, sr.Verified, "cancelled after %d checks", n)
+		assert.Equal(t, n >= 2, sr.Escrow != nil, "cancelled after %d checks", n)
+		assert.Nil(t, sr.TagProof, "cancelled after %d checks", n)
+	}
+
+	sr := σ.report(&cancelAfter{Context: context.Background(), n: 5}, pp, msg, prefix, false)
+	assert.True(t, sr.Verified)
+	assert.EqualError(t, sr.Escrow, "escrow proof invalid")
+	assert.EqualError(t, sr.TagProof, "tag proof invalid")
+}
@@ -7,15 +7,19 @@ SPDX-License-Identifier: Apache-2.0
 package threshold
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/asn1"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	. "privacy-perserving-audit/common"
 	. "privacy-perserving-audit/dory"
 	"privacy-perserving-audit/tag"
-	"sync"
-	"sync/atomic"
+	"sort"
 
 	math "github.com/IBM/mathlib"
 )
@@ -25,24 +29,56 @@ var (
 	lambda = curve.FieldBytes
 )
 
+var (
+	// ErrNotInRing is returned when signing with a key whose public key is not in the ring.
+	ErrNotInRing = errors.New("PK not found within ring")
+	// ErrRingSizeMismatch is returned when a ring does not match the size of the ring the parameters were computed for.
+	ErrRingSizeMismatch = errors.New("ring size mismatch")
+)
+
 type PrivateKey math.Zr
 
-func (key PrivateKey) locatePK(ring Ring) (PublicKey, int) {
+func (key PrivateKey) findPK(ring Ring) (PublicKey, int, error) {
 	sk := math.Zr(key)
 	myPK := curve.GenG1.Mul(&sk)
 	for i := 0; i < len(ring); i++ {
-		if ring[i].Equals(myPK) {
-			return PublicKey(*myPK), i
+		if ring[i] != nil && ring[i].Equals(myPK) {
+			return PublicKey(*myPK), i, nil
 		}
 	}
 
-	panic("PK not found within ring")
+	return PublicKey{}, 0, ErrNotInRing
 }
 
 type PublicKey math.G1
 
 type Ring G1v
 
+// paddingKey returns the public key placed at position i of a padded ring.
+// It is hashed to the curve, hence nobody knows its discrete logarithm and it cannot be signed for.
+func paddingKey(i int) *math.G1 {
+	index := make([]byte, 8)
+	binary.BigEndian.PutUint64(index, uint64(i))
+	return curve.HashToG1(append([]byte("DualDory ring padding"), index...))
+}
+
+// Pad extends the ring with padding keys up to size n.
+// Rings are padded to the next power of two, see PaddedSize, and the cost of pre-processing, signing
+// and verifying is that of the padded ring: a ring of 600 members costs as much as one of 1024.
+func (r Ring) Pad(n int) Ring {
+	if len(r) > n {
+		panic(fmt.Sprintf("ring of size %d exceeds %d", len(r), n))
+	}
+
+	padded := make(Ring, n)
+	copy(padded, r)
+	for i := len(r); i < n; i++ {
+		padded[i] = paddingKey(i)
+	}
+
+	return padded
+}
+
 func (r Ring) Neg() Ring {
 	return Ring(G1v(r).Neg())
 }
@@ -60,16 +96,100 @@ type PublicParams struct {
 	DoryParams []PP
 }
 
+// An Option configures how signatures are made and verified with public parameters,
+// see PublicParams.With and ThresholdParams.With.
+type Option func(doryParams []PP) []PP
+
+// WithWorkers bounds to n the number of goroutines that signing, verification, batch verification
+// and the Dory proofs run on, in addition to the goroutines that call them, instead of the number of CPUs.
+// The workers are shared by all public parameters the option is applied to.
+func WithWorkers(n int) Option {
+	executor := NewExecutor(n)
+	return func(doryParams []PP) []PP {
+		return WithExecutor(doryParams, executor)
+	}
+}
+
+// With returns a copy of the public parameters configured with the given options.
+func (pp PublicParams) With(opts ...Option) PublicParams {
+	for _, opt := range opts {
+		pp.DoryParams = opt(pp.DoryParams)
+	}
+	return pp
+}
+
+// executorOf returns the executor the Dory public parameters run on, nil being the default one.
+func executorOf(doryParams []PP) *Executor {
+	if len(doryParams) == 0 {
+		return nil
+	}
+	return doryParams[0].Executor()
+}
+
 type PreProcessedParams struct {
-	digest    []byte
-	A0Inverse *math.Gt
-	D         *math.Gt
-	Γ2        *math.G2
-	H1        G1v
+	digest []byte
+	// previousDigest is the digest of the pre-processed parameters of the previous epoch
+	previousDigest []byte
+	epoch          uint64
+	ringSize       int
+	A0Inverse      *math.Gt
+	D              *math.Gt
+	Γ2             *math.G2
+	H1             G1v
+}
+
+// RingSize returns the number of members in the ring, without the padding.
+func (ppp PreProcessedParams) RingSize() int {
+	return ppp.ringSize
+}
+
+// Epoch returns the number of updates applied to the pre-processed parameters since they were computed.
+func (ppp PreProcessedParams) Epoch() uint64 {
+	return ppp.epoch
+}
+
+// Digest returns the digest of the pre-processed parameters, which is chained to the digest of the previous epoch.
+func (ppp PreProcessedParams) Digest() []byte {
+	return ppp.digest
 }
 
 func (ppp PreProcessedParams) computeDigest(doryParams []PP) []byte {
+	ringSize := make([]byte, 8)
+	binary.BigEndian.PutUint64(ringSize, uint64(ppp.ringSize))
+	epoch := make([]byte, 8)
+	binary.BigEndian.PutUint64(epoch, ppp.epoch)
+
+	h := sha256.New()
+	h.Write(epoch)
+	h.Write(ppp.previousDigest)
+	h.Write(ringSize)
+	h.Write(ppp.D.Bytes())
+	h.Write(ppp.A0Inverse.Bytes())
+	h.Write(ppp.Γ2.Bytes())
+	h.Write(ppp.H1.Bytes())
+	h.Write(doryParams[len(doryParams)-1].Digest(nil))
+	return h.Sum(nil)
+}
+
+// computeDigestV1 computes the digest of pre-processed parameters serialized with version 1,
+// which has neither epoch nor ring size, as the ring fills the Dory public parameters.
+func (ppp PreProcessedParams) computeDigestV1(doryParams []PP) []byte {
+	h := sha256.New()
+	h.Write(ppp.D.Bytes())
+	h.Write(ppp.A0Inverse.Bytes())
+	h.Write(ppp.Γ2.Bytes())
+	h.Write(ppp.H1.Bytes())
+	h.Write(doryParams[len(doryParams)-1].Digest(nil))
+	return h.Sum(nil)
+}
+
+// computeDigestV2 computes the digest of pre-processed parameters serialized with version 2, which has no epoch.
+func (ppp PreProcessedParams) computeDigestV2(doryParams []PP) []byte {
+	ringSize := make([]byte, 8)
+	binary.BigEndian.PutUint64(ringSize, uint64(ppp.ringSize))
+
 	h := sha256.New()
+	h.Write(ringSize)
 	h.Write(ppp.D.Bytes())
 	h.Write(ppp.A0Inverse.Bytes())
 	h.Write(ppp.Γ2.Bytes())
@@ -78,15 +198,19 @@ func (ppp PreProcessedParams) computeDigest(doryParams []PP) []byte {
 	return h.Sum(nil)
 }
 
+// ComputePreProcessedParams computes the pre-processed parameters of the given ring.
+// If the ring is smaller than the Dory public parameters, it is padded with keys nobody can sign for.
 func ComputePreProcessedParams(doryParams []PP, ring Ring) PreProcessedParams {
 	pp := doryParams[0]
-	A0 := ring.InnerProd(pp.Γ2)
+	n := len(pp.Γ2)
+	A0 := ring.Pad(n).InnerProd(pp.Γ2)
 	A0.Inverse()
-	H1 := G1v{H()}.Duplicate(len(ring))
+	H1 := G1v{H()}.Duplicate(n)
 	D := H1.InnerProd(pp.Γ2)
 	Γ2 := pp.Γ2.Sum()
 
 	ppp := PreProcessedParams{
+		ringSize:  len(ring),
 		Γ2:        Γ2,
 		A0Inverse: A0,
 		D:         D,
@@ -97,9 +221,237 @@ func ComputePreProcessedParams(doryParams []PP, ring Ring) PreProcessedParams {
 	return ppp
 }
 
+// RingChange replaces the key at position Index of the ring with Key.
+// If Index is the size of the ring, Key is appended to the ring.
+// For a weighted ring, the keys are the weighted keys of its members, see WeightedKey.
+// If Key is nil, the key at position Index is removed and the last key of the ring takes its place.
+type RingChange struct {
+	Index int
+	Key   *math.G1
+}
+
+// UpdatePreProcessedParams applies the changes to the ring the pre-processed parameters were computed for,
+// and returns the pre-processed parameters of the next epoch along with the new ring.
+// Only the pairings of the positions that changed are computed, hence verifiers
+// that hold the pre-processed parameters can apply the same changes and arrive at the same digest.
+func UpdatePreProcessedParams(doryParams []PP, ppp PreProcessedParams, oldRing Ring, changes ...RingChange) (PreProcessedParams, Ring, error) {
+	if len(oldRing) != ppp.ringSize {
+		return PreProcessedParams{}, nil, fmt.Errorf("ring of size %d does not match pre-processed parameters of a ring of size %d", len(oldRing), ppp.ringSize)
+	}
+
+	Γ2 := doryParams[0].Γ2
+	n := len(Γ2)
+
+	ring := append(Ring{}, oldRing...)
+	changed := make(map[int]bool)
+
+	for _, change := range changes {
+		i := change.Index
+		switch {
+		case i < 0 || i > len(ring) || (i == len(ring) && change.Key == nil):
+			return PreProcessedParams{}, nil, fmt.Errorf("index %d out of range for a ring of size %d", i, len(ring))
+		case change.Key == nil:
+			last := len(ring) - 1
+			ring[i] = ring[last]
+			ring = ring[:last]
+			changed[i], changed[last] = true, true
+		case i == len(ring):
+			if len(ring) == n {
+				return PreProcessedParams{}, nil, fmt.Errorf("ring is full, Dory parameters support only %d keys", n)
+			}
+			ring = append(ring, change.Key)
+			changed[i] = true
+		default:
+			ring[i] = change.Key
+			changed[i] = true
+		}
+	}
+
+	if len(ring) == 0 {
+		return PreProcessedParams{}, nil, fmt.Errorf("ring cannot be empty")
+	}
+
+	// A0 changes by the pairing of the difference between the new and the old key at every changed position
+	oldPadded, padded := oldRing.Pad(n), ring.Pad(n)
+	var diffs G1v
+	var generators G2v
+	for i := range changed {
+		diff := padded[i].Copy()
+		diff.Sub(oldPadded[i])
+		diffs = append(diffs, diff)
+		generators = append(generators, Γ2[i])
+	}
+
+	updated := ppp
+	updated.ringSize = len(ring)
+	updated.epoch = ppp.epoch + 1
+	updated.previousDigest = ppp.digest
+
+	if len(diffs) > 0 {
+		delta := diffs.InnerProd(generators)
+		delta.Inverse()
+		delta.Mul(ppp.A0Inverse)
+		updated.A0Inverse = delta
+	}
+
+	updated.digest = updated.computeDigest(doryParams)
+	return updated, ring, nil
+}
+
+const (
+	publicParamsVersion = 3
+	// publicParamsVersion2 predates epochs. Its parameters are loaded as those of epoch 0.
+	publicParamsVersion2 = 2
+	// publicParamsVersion1 predates padding, the ring fills the Dory public parameters.
+	// Its parameters are loaded as those of epoch 0 as well.
+	publicParamsVersion1 = 1
+)
+
+// RawPublicParams is the versioned wire format of PublicParams.
+type RawPublicParams struct {
+	Version            int
+	DoryParams         []byte
+	PreProcessedParams RawPreProcessedParams
+}
+
+// RawPreProcessedParams is the wire format of PreProcessedParams.
+// H1 is not stored as it consists of copies of H, as many as the size of the Dory public parameters.
+type RawPreProcessedParams struct {
+	Digest         []byte
+	A0Inverse      []byte
+	D              []byte
+	Γ2             []byte
+	RingSize       int
+	Epoch          int64  `asn1:"optional"`
+	PreviousDigest []byte `asn1:"optional"`
+}
+
+func (pp PublicParams) Bytes() []byte {
+	bytes, err := asn1.Marshal(RawPublicParams{
+		Version:    publicParamsVersion,
+		DoryParams: PPsBytes(pp.DoryParams),
+		PreProcessedParams: RawPreProcessedParams{
+			Digest:         pp.digest,
+			A0Inverse:      pp.A0Inverse.Bytes(),
+			D:              pp.D.Bytes(),
+			Γ2:             pp.Γ2.Bytes(),
+			RingSize:       pp.ringSize,
+			Epoch:          int64(pp.epoch),
+			PreviousDigest: pp.previousDigest,
+		},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	return bytes
+}
+
+// PublicParamsFromBytes loads public parameters serialized by PublicParams.Bytes().
+// The digests of the Dory parameters and the pre-processed parameters are recomputed
+// and compared against the stored ones.
+// Parameters of versions 1 and 2, which have no epoch, are loaded as those of epoch 0:
+// their digest is checked as computed by their version, and then recomputed with no previous digest.
+func PublicParamsFromBytes(serialized []byte) (PublicParams, error) {
+	var rpp RawPublicParams
+	rest, err := asn1.Unmarshal(serialized, &rpp)
+	if err != nil {
+		return PublicParams{}, fmt.Errorf("failed unmarshaling public parameters: %v", err)
+	}
+	if len(rest) > 0 {
+		return PublicParams{}, fmt.Errorf("trailing bytes after public parameters")
+	}
+
+	switch rpp.Version {
+	case publicParamsVersion, publicParamsVersion2, publicParamsVersion1:
+	default:
+		return PublicParams{}, fmt.Errorf("unsupported public parameters version %d", rpp.Version)
+	}
+
+	doryParams, err := PPsFromBytes(rpp.DoryParams)
+	if err != nil {
+		return PublicParams{}, fmt.Errorf("invalid Dory parameters: %v", err)
+	}
+
+	raw := rpp.PreProcessedParams
+
+	if raw.RingSize <= 0 || raw.RingSize > len(doryParams[0].Γ1) {
+		return PublicParams{}, fmt.Errorf("ring size %d does not match Dory parameters of size %d", raw.RingSize, len(doryParams[0].Γ1))
+	}
+
+	if raw.Epoch < 0 || (raw.Epoch == 0) != (len(raw.PreviousDigest) == 0) {
+		return PublicParams{}, fmt.Errorf("invalid epoch %d", raw.Epoch)
+	}
+
+	if rpp.Version != publicParamsVersion && raw.Epoch != 0 {
+		return PublicParams{}, fmt.Errorf("public parameters of version %d have no epoch", rpp.Version)
+	}
+
+	ppp := PreProcessedParams{
+		ringSize:       raw.RingSize,
+		epoch:          uint64(raw.Epoch),
+		previousDigest: raw.PreviousDigest,
+	}
+
+	if ppp.A0Inverse, err = GtFromBytes(raw.A0Inverse); err != nil {
+		return PublicParams{}, fmt.Errorf("invalid A0Inverse: %v", err)
+	}
+	if ppp.D, err = GtFromBytes(raw.D); err != nil {
+		return PublicParams{}, fmt.Errorf("invalid D: %v", err)
+	}
+	if ppp.Γ2, err = G2FromBytes(raw.Γ2); err != nil {
+		return PublicParams{}, fmt.Errorf("invalid Γ2: %v", err)
+	}
+	if !ppp.Γ2.Equals(doryParams[0].Γ2.Sum()) {
+		return PublicParams{}, fmt.Errorf("Γ2 does not match Dory parameters")
+	}
+
+	ppp.H1 = G1v{H()}.Duplicate(len(doryParams[0].Γ1))
+
+	ppp.digest = ppp.computeDigest(doryParams)
+	expected := ppp.digest
+	switch rpp.Version {
+	case publicParamsVersion1:
+		expected = ppp.computeDigestV1(doryParams)
+		// Padded rings were serialized with the digest of version 2 before it was introduced
+		if raw.RingSize != len(doryParams[0].Γ1) || !bytes.Equal(expected, raw.Digest) {
+			expected = ppp.computeDigestV2(doryParams)
+		}
+	case publicParamsVersion2:
+		expected = ppp.computeDigestV2(doryParams)
+	}
+
+	if !bytes.Equal(expected, raw.Digest) {
+		return PublicParams{}, fmt.Errorf("pre-processed parameters digest mismatch")
+	}
+
+	return PublicParams{
+		PreProcessedParams: ppp,
+		DoryParams:         doryParams,
+	}, nil
+}
+
 func KeyGen() (PublicKey, PrivateKey) {
-	sk := curve.NewRandomZr(rand.Reader)
-	return PublicKey(*curve.GenG1.Mul(sk)), PrivateKey(*sk)
+	return KeyGenFrom(rand.Reader)
+}
+
+// KeyGenFrom generates a key pair with randomness read from rnd.
+func KeyGenFrom(rnd io.Reader) (PublicKey, PrivateKey) {
+	pk, sk, err := TryKeyGenFrom(rnd)
+	if err != nil {
+		panic(err)
+	}
+	return pk, sk
+}
+
+// TryKeyGenFrom is KeyGenFrom, but returns an error instead of panicking if rnd fails.
+func TryKeyGenFrom(rnd io.Reader) (PublicKey, PrivateKey, error) {
+	sk, err := RandomZr(rnd)
+	if err != nil {
+		return PublicKey{}, PrivateKey{}, err
+	}
+	return PublicKey(*curve.GenG1.Mul(sk)), PrivateKey(*sk), nil
 }
 
 type RingSignature struct {
@@ -111,56 +463,219 @@ type RingSignature struct {
 	B             *math.Gt
 	Z             *math.Zr
 	Y             *math.G1
+	// WeightCommitment is the commitment w U + s H to the weight w of the signer in a weighted ring, and nil otherwise
+	WeightCommitment *math.G1
+	// Trace is the trace tag of the message if the signature is traceable, and nil otherwise
+	Trace *tag.Trace
+	// Escrow is the encryption of the public key of the signer if the signature is accountable, and nil otherwise
+	Escrow *Escrow
+	// transcript is the state of the transcript after the ring proof, used to append the tag proof
+	transcript *Transcript
+}
+
+// Link returns whether two signatures made under the same prefix were made by the same signer.
+func Link(σ1, σ2 RingSignature) bool {
+	return σ1.TagValue.Equals(σ2.TagValue)
 }
 
+// LinkAll groups signatures made under the same prefix by their signer.
+// It maps the bytes of every tag to the indices of the signatures carrying it.
+func LinkAll(signatures []RingSignature) map[string][]int {
+	return linkTags(tagsOf(signatures))
+}
+
+func linkTags(tags []*math.G1) map[string][]int {
+	res := make(map[string][]int)
+	for i, tag := range tags {
+		if tag == nil {
+			// Only a malformed signature has no tag, and it is linked to no other signature
+			res[fmt.Sprintf("missing tag %d", i)] = []int{i}
+			continue
+		}
+		t := string(tag.Bytes())
+		res[t] = append(res[t], i)
+	}
+	return res
+}
+
+func tagsOf(signatures []RingSignature) []*math.G1 {
+	tags := make([]*math.G1, len(signatures))
+	for i, σ := range signatures {
+		tags[i] = σ.TagValue
+	}
+	return tags
+}
+
+// LinkedSignaturesError is returned when several signatures of a set were made by the same signer.
+type LinkedSignaturesError struct {
+	// Linked holds the indices of signatures made by the same signer, for every signer that signed more than once.
+	Linked     [][]int
+	Signers    int
+	Signatures int
+}
+
+func (e *LinkedSignaturesError) Error() string {
+	return fmt.Sprintf("signature set was signed by %d out of %d distinct signers", e.Signers, e.Signatures)
+}
+
+func checkLinked(tags []*math.G1) *LinkedSignaturesError {
+	linked := linkTags(tags)
+	if len(linked) == len(tags) {
+		return nil
+	}
+
+	err := &LinkedSignaturesError{
+		Signers:    len(linked),
+		Signatures: len(tags),
+	}
+
+	for _, indices := range linked {
+		if len(indices) > 1 {
+			err.Linked = append(err.Linked, indices)
+		}
+	}
+
+	sort.Slice(err.Linked, func(i, j int) bool {
+		return err.Linked[i][0] < err.Linked[j][0]
+	})
+
+	return err
+}
+
+// VerifyThresholdSignatures verifies that the signatures are valid and were made by distinct signers.
+// If some are not, the error is that of the lowest indexed invalid signature.
+// Use VerifyThresholdSignaturesWithContext to get the result of every check of every signature.
 func VerifyThresholdSignatures(pp PublicParams, msg, prefix []byte, signatures ...RingSignature) error {
-	tags := make(map[string]struct{})
-	for _, σ := range signatures {
-		tags[string(σ.TagValue.Bytes())] = struct{}{}
+	return verifyThresholdSignatures(pp, msg, prefix, false, signatures...)
+}
+
+// verifyThresholdSignatures is VerifyThresholdSignatures over a weighted ring if weighted is set.
+func verifyThresholdSignatures(pp PublicParams, msg, prefix []byte, weighted bool, signatures ...RingSignature) error {
+	if err := checkLinked(tagsOf(signatures)); err != nil {
+		return err
 	}
 
-	if len(tags) != len(signatures) {
-		return fmt.Errorf("signature set was signed by %d out of %d distinct signers", len(tags), len(signatures))
+	report, err := verifyWithContext(context.Background(), pp, msg, prefix, weighted, signatures...)
+	if err != nil {
+		return err
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(len(signatures))
+	return report.Err()
+}
 
-	atomicErr := atomic.Value{}
+// BatchVerificationError is returned by VerifyBatch when some of the signatures are invalid.
+type BatchVerificationError struct {
+	// Invalid are the indices of the invalid signatures, in increasing order.
+	Invalid    []int
+	Signatures int
+}
 
-	for _, σ := range signatures {
-		go func(σ RingSignature) {
-			defer wg.Done()
+func (err *BatchVerificationError) Error() string {
+	return fmt.Sprintf("%d out of %d signatures are invalid: %v", len(err.Invalid), err.Signatures, err.Invalid)
+}
 
-			err := σ.Verify(pp, msg, prefix)
-			if err != nil {
-				atomicErr.Store(err)
+// VerifyBatch verifies signatures on the same message and prefix at once.
+// The final pairing equations of all Dory proofs are merged into a single multi-pairing
+// and the equations of all tag proofs into a single sum, each weighted by a random scalar.
+// If the batch does not verify, it is bisected in order to locate the invalid signatures.
+func VerifyBatch(pp PublicParams, msg, prefix []byte, signatures ...RingSignature) error {
+	checks := make([]signatureChecks, len(signatures))
+
+	tasks := make([]func(), len(signatures))
+	for i := range signatures {
+		i := i
+		tasks[i] = func() {
+			checks[i] = signatures[i].prepareVerification(pp, msg, prefix, false)
+			if checks[i].malformed == nil {
+				checks[i].escrow = signatures[i].verifyEscrow(checks[i].transcript)
 			}
+		}
+	}
 
-		}(σ)
+	executorOf(pp.DoryParams).Parallel(tasks...)
+
+	indices := make([]int, len(signatures))
+	for i := range indices {
+		indices[i] = i
 	}
 
-	wg.Wait()
+	invalid := bisect(checks, indices)
+	if len(invalid) == 0 {
+		return nil
+	}
 
-	if atomicErr.Load() == nil {
+	return &BatchVerificationError{
+		Invalid:    invalid,
+		Signatures: len(signatures),
+	}
+}
+
+// bisect returns the indices of the invalid signatures among the given ones.
+func bisect(checks []signatureChecks, indices []int) []int {
+	if len(indices) == 0 || batchVerify(checks, indices) == nil {
 		return nil
 	}
 
-	return atomicErr.Load().(error)
+	if len(indices) == 1 {
+		return indices
+	}
+
+	half := len(indices) / 2
+	return append(bisect(checks, indices[:half]), bisect(checks, indices[half:])...)
+}
+
+func batchVerify(checks []signatureChecks, indices []int) error {
+	var finalChecks []FinalCheck
+	var tagChecks []tag.Check
+
+	for _, i := range indices {
+		if checks[i].malformed != nil {
+			return checks[i].malformed
+		}
+		if checks[i].escrow != nil {
+			return checks[i].escrow
+		}
+		finalChecks = append(finalChecks, checks[i].ringProof, checks[i].sumProof)
+		tagChecks = append(tagChecks, checks[i].tagProof)
+	}
+
+	if err := BatchVerify(finalChecks); err != nil {
+		return err
+	}
+
+	return tag.BatchVerify(tagChecks)
 }
 
 func (rs RingSignature) Bytes() []byte {
-	bytes, err := asn1.Marshal(SerializedSignature{
-		TagValue:      rs.TagValue.Bytes(),
+	ss := SerializedSignature{
 		TagCommitment: rs.TagCommitment.Bytes(),
-		TagProof:      rs.TagProof.Bytes(),
 		B:             rs.B.Bytes(),
 		Y:             rs.Y.Bytes(),
 		Z:             rs.Z.Bytes(),
 		DoryProof1:    rs.DoryProof1.Bytes(),
 		DoryProof2:    rs.DoryProof2.Bytes(),
-	})
+	}
 
+	if rs.WeightCommitment != nil {
+		ss.WeightCommitment = rs.WeightCommitment.Bytes()
+	}
+
+	// A ring proof produced by RingProof is stored without a tag until AppendTagProof is called
+	if rs.TagValue != nil {
+		ss.TagValue = rs.TagValue.Bytes()
+		ss.TagProof = rs.TagProof.Bytes()
+	}
+
+	if rs.Trace != nil {
+		ss.TraceTag = rs.Trace.Tag.Bytes()
+		ss.TraceCommitment = rs.Trace.C.Bytes()
+	}
+
+	if rs.Escrow != nil {
+		ss.Escrow = rs.Escrow.Bytes()
+	}
+
+	bytes, err := asn1.Marshal(ss)
 	if err != nil {
 		panic(err)
 	}
@@ -169,70 +684,403 @@ func (rs RingSignature) Bytes() []byte {
 }
 
 type SerializedSignature struct {
-	TagProof      []byte
-	TagCommitment []byte
-	TagValue      []byte
-	DoryProof1    []byte
-	DoryProof2    []byte
-	B             []byte
-	Z             []byte
-	Y             []byte
+	TagProof         []byte
+	TagCommitment    []byte
+	TagValue         []byte
+	DoryProof1       []byte
+	DoryProof2       []byte
+	B                []byte
+	Z                []byte
+	Y                []byte
+	WeightCommitment []byte `asn1:"optional,tag:3"`
+	TraceTag         []byte `asn1:"optional"`
+	TraceCommitment  []byte `asn1:"optional"`
+	Escrow           []byte `asn1:"optional,tag:2"`
+}
+
+func SignatureFromBytes(bytes []byte) (RingSignature, error) {
+	var ss SerializedSignature
+	rest, err := asn1.Unmarshal(bytes, &ss)
+	if err != nil {
+		return RingSignature{}, fmt.Errorf("failed unmarshaling signature: %v", err)
+	}
+	if len(rest) > 0 {
+		return RingSignature{}, fmt.Errorf("trailing bytes after signature")
+	}
+
+	var rs RingSignature
+
+	if (len(ss.TagValue) == 0) != (len(ss.TagProof) == 0) {
+		return RingSignature{}, fmt.Errorf("incomplete tag")
+	}
+	if len(ss.TagValue) > 0 {
+		if rs.TagProof, err = tag.ProofFromBytes(ss.TagProof); err != nil {
+			return RingSignature{}, fmt.Errorf("invalid tag proof: %v", err)
+		}
+		if rs.TagValue, err = G1FromBytes(ss.TagValue); err != nil {
+			return RingSignature{}, fmt.Errorf("invalid tag value: %v", err)
+		}
+	}
+	if rs.TagCommitment, err = G1FromBytes(ss.TagCommitment); err != nil {
+		return RingSignature{}, fmt.Errorf("invalid tag commitment: %v", err)
+	}
+	if rs.DoryProof1, err = ProofFromBytes(ss.DoryProof1); err != nil {
+		return RingSignature{}, fmt.Errorf("invalid first Dory proof: %v", err)
+	}
+	if rs.DoryProof2, err = ProofFromBytes(ss.DoryProof2); err != nil {
+		return RingSignature{}, fmt.Errorf("invalid second Dory proof: %v", err)
+	}
+	if rs.B, err = GtFromBytes(ss.B); err != nil {
+		return RingSignature{}, fmt.Errorf("invalid B: %v", err)
+	}
+	if rs.Z, err = ZrFromBytes(ss.Z); err != nil {
+		return RingSignature{}, fmt.Errorf("invalid Z: %v", err)
+	}
+	if rs.Y, err = G1FromBytes(ss.Y); err != nil {
+		return RingSignature{}, fmt.Errorf("invalid Y: %v", err)
+	}
+	if len(ss.WeightCommitment) > 0 {
+		if rs.WeightCommitment, err = G1FromBytes(ss.WeightCommitment); err != nil {
+			return RingSignature{}, fmt.Errorf("invalid weight commitment: %v", err)
+		}
+	}
+
+	if (len(ss.TraceTag) == 0) != (len(ss.TraceCommitment) == 0) {
+		return RingSignature{}, fmt.Errorf("incomplete trace")
+	}
+	if len(ss.TraceTag) > 0 {
+		rs.Trace = &tag.Trace{}
+		if rs.Trace.Tag, err = G1FromBytes(ss.TraceTag); err != nil {
+			return RingSignature{}, fmt.Errorf("invalid trace tag: %v", err)
+		}
+		if rs.Trace.C, err = G1FromBytes(ss.TraceCommitment); err != nil {
+			return RingSignature{}, fmt.Errorf("invalid trace commitment: %v", err)
+		}
+	}
+
+	if len(ss.Escrow) > 0 {
+		esc, err := EscrowFromBytes(ss.Escrow)
+		if err != nil {
+			return RingSignature{}, err
+		}
+		rs.Escrow = &esc
+	}
+
+	return rs, nil
 }
 
 func (rs RingSignature) Verify(pp PublicParams, m, prefix []byte) error {
-	A := e(rs.TagCommitment, pp.Γ2)
-	A.Mul(pp.A0Inverse)
+	return rs.Report(pp, m, prefix).Err()
+}
+
+// Validate checks that the signature is well formed with respect to the public parameters:
+// its Dory proofs have a round for every Dory parameters but the last, and all of its elements are present,
+// in their prime order subgroups, and its commitments and tag are not the identity.
+// Verify skips the subgroup checks, which SignatureFromBytes already performs.
+func (rs RingSignature) Validate(pp PublicParams) error {
+	if err := validateRingProof(pp, rs.TagCommitment, rs.B, rs.Z, rs.Y, rs.DoryProof1, rs.DoryProof2); err != nil {
+		return err
+	}
+
+	if err := checkPoint(rs.TagValue); err != nil {
+		return fmt.Errorf("malformed signature: invalid tag: %v", err)
+	}
+
+	if err := rs.TagProof.Validate(); err != nil {
+		return fmt.Errorf("malformed signature: invalid tag proof: %v", err)
+	}
+
+	if rs.WeightCommitment != nil {
+		if err := CheckG1(rs.WeightCommitment); err != nil {
+			return fmt.Errorf("malformed signature: invalid weight commitment: %v", err)
+		}
+	}
+
+	if rs.Trace != nil {
+		if err := checkPoint(rs.Trace.Tag); err != nil {
+			return fmt.Errorf("malformed signature: invalid trace tag: %v", err)
+		}
+		if err := CheckG1(rs.Trace.C); err != nil {
+			return fmt.Errorf("malformed signature: invalid trace commitment: %v", err)
+		}
+	}
+
+	if rs.Escrow != nil {
+		if err := rs.Escrow.validate(); err != nil {
+			return fmt.Errorf("malformed signature: invalid escrow: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// validateRingProof validates the elements of the ring proof a signature is made of.
+func validateRingProof(pp PublicParams, com *math.G1, B *math.Gt, Z *math.Zr, Y *math.G1, π1, π2 Proof) error {
+	if err := pp.check(); err != nil {
+		return err
+	}
+
+	if err := checkPoint(com); err != nil {
+		return fmt.Errorf("malformed signature: invalid tag commitment: %v", err)
+	}
+	if err := checkPoint(Y); err != nil {
+		return fmt.Errorf("malformed signature: invalid Y: %v", err)
+	}
+	if err := CheckZr(Z); err != nil {
+		return fmt.Errorf("malformed signature: invalid Z: %v", err)
+	}
+	if err := CheckGt(B); err != nil {
+		return fmt.Errorf("malformed signature: invalid B: %v", err)
+	}
+	if B.IsUnity() {
+		return fmt.Errorf("malformed signature: invalid B: identity element")
+	}
+
+	if err := π1.Validate(pp.DoryParams); err != nil {
+		return fmt.Errorf("malformed signature: invalid first Dory proof: %w", err)
+	}
+	if err := π2.Validate(pp.DoryParams); err != nil {
+		return fmt.Errorf("malformed signature: invalid second Dory proof: %w", err)
+	}
+
+	return nil
+}
+
+// checkPoint checks that g is a valid G1 element other than the identity.
+func checkPoint(g *math.G1) error {
+	if err := CheckG1(g); err != nil {
+		return err
+	}
+	return checkNotIdentity(g)
+}
+
+// checkNotIdentity checks that g is present and not the identity, without checking its subgroup.
+func checkNotIdentity(g *math.G1) error {
+	if g == nil {
+		return fmt.Errorf("missing G1 element")
+	}
+	if g.IsInfinity() {
+		return fmt.Errorf("identity element")
+	}
+	return nil
+}
+
+// check is Validate without the subgroup checks, that is, what verification needs to not panic
+// and to not be trivially satisfied. A signature carries a weight commitment if and only if the ring is weighted,
+// as the weight commitment is folded into the ring statement: over an unweighted ring,
+// a weight commitment pk - sk' g + t H would let anyone with a key sk' outside of the ring sign for pk.
+func (rs RingSignature) check(pp PublicParams, weighted bool) error {
+	if err := checkRingProof(pp, rs.TagCommitment, rs.B, rs.Z, rs.Y, rs.DoryProof1, rs.DoryProof2); err != nil {
+		return err
+	}
+
+	if weighted && rs.WeightCommitment == nil {
+		return fmt.Errorf("malformed signature: missing weight commitment")
+	}
+	if !weighted && rs.WeightCommitment != nil {
+		return fmt.Errorf("malformed signature: unexpected weight commitment")
+	}
+
+	if err := checkNotIdentity(rs.TagValue); err != nil {
+		return fmt.Errorf("malformed signature: invalid tag: %v", err)
+	}
+
+	if err := rs.TagProof.CheckShape(); err != nil {
+		return fmt.Errorf("malformed signature: invalid tag proof: %v", err)
+	}
+
+	if rs.Trace != nil {
+		if err := checkNotIdentity(rs.Trace.Tag); err != nil {
+			return fmt.Errorf("malformed signature: invalid trace tag: %v", err)
+		}
+		if rs.Trace.C == nil {
+			return fmt.Errorf("malformed signature: invalid trace commitment: missing G1 element")
+		}
+	}
+
+	if rs.Escrow != nil {
+		if err := rs.Escrow.checkShape(); err != nil {
+			return fmt.Errorf("malformed signature: invalid escrow: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// checkRingProof is validateRingProof without the subgroup checks.
+func checkRingProof(pp PublicParams, com *math.G1, B *math.Gt, Z *math.Zr, Y *math.G1, π1, π2 Proof) error {
+	if err := pp.check(); err != nil {
+		return err
+	}
+
+	if err := checkNotIdentity(com); err != nil {
+		return fmt.Errorf("malformed signature: invalid tag commitment: %v", err)
+	}
+	if err := checkNotIdentity(Y); err != nil {
+		return fmt.Errorf("malformed signature: invalid Y: %v", err)
+	}
+	if Z == nil {
+		return fmt.Errorf("malformed signature: invalid Z: missing scalar")
+	}
+	if B == nil {
+		return fmt.Errorf("malformed signature: invalid B: missing Gt element")
+	}
+	if B.IsUnity() {
+		return fmt.Errorf("malformed signature: invalid B: identity element")
+	}
+
+	if err := π1.CheckShape(pp.DoryParams); err != nil {
+		return fmt.Errorf("malformed signature: invalid first Dory proof: %w", err)
+	}
+	if err := π2.CheckShape(pp.DoryParams); err != nil {
+		return fmt.Errorf("malformed signature: invalid second Dory proof: %w", err)
+	}
+
+	return nil
+}
+
+// signatureChecks are the final equations a ring signature is verified against.
+type signatureChecks struct {
+	ringProof, sumProof FinalCheck
+	tagProof            tag.Check
+	// escrow is the result of verifying the escrow of an accountable signature, which is not batched, see verifyEscrow
+	escrow error
+	// malformed is set if the signature failed validation, in which case there are no equations to check
+	malformed error
+	// transcript is the transcript after the ring proof, which the escrow proof is derived from
+	transcript *Transcript
+}
+
+// verifyEscrow verifies the escrow of an accountable signature given the transcript after its ring proof.
+// It is not part of prepareVerification, so that it can be cancelled along with the other sub-proofs.
+func (rs RingSignature) verifyEscrow(t *Transcript) error {
+	if rs.Escrow == nil {
+		return nil
+	}
+	return rs.Escrow.verify(escrowTranscript(t), rs.TagCommitment)
+}
+
+func (rs RingSignature) prepareVerification(pp PublicParams, m, prefix []byte, weighted bool) signatureChecks {
+	var checks signatureChecks
+
+	if err := rs.check(pp, weighted); err != nil {
+		checks.malformed = err
+		return checks
+	}
+
+	var t *Transcript
+	checks.ringProof, checks.sumProof, t = rs.prepareRingVerification(pp)
+	checks.transcript = t
+
+	if rs.Trace == nil {
+		checks.tagProof = rs.TagProof.PrepareVerification(tagTranscript(t, m), rs.TagValue, rs.TagCommitment, prefix)
+	} else {
+		checks.tagProof = rs.TagProof.PrepareTraceableVerification(tagTranscript(t, m), rs.TagValue, rs.TagCommitment, prefix, m, *rs.Trace)
+	}
+
+	return checks
+}
+
+// prepareRingVerification returns the final checks of the two Dory proofs of the ring proof,
+// along with the transcript after both proofs are appended to it.
+func (rs RingSignature) prepareRingVerification(pp PublicParams) (FinalCheck, FinalCheck, *Transcript) {
+	A := rs.ringStatement(pp)
 
 	h1zByY := H().Mul(rs.Z)
 	h1zByY.Sub(rs.Y)
 	C := e(h1zByY, curve.GenG2)
 
-	h := hashToZr(A.Bytes(), rs.Y.Bytes(), pp.digest)
+	t := ringTranscript(pp, rs.TagCommitment, A, rs.Y)
+	h := t.ChallengeZr("h")
 	E := e(H().Mul(h), curve.GenG2)
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	atomicErr := atomic.Value{}
+	ringProofTranscript, sumProofTranscript := t.Fork("ring"), t.Fork("sum")
 
-	go func() {
-		defer wg.Done()
+	var ringProof, sumProof FinalCheck
 
-		if err := VerifyReduce(pp.DoryParams, Commitment{
+	executorOf(pp.DoryParams).Parallel(func() {
+		ringProof = PrepareVerification(ringProofTranscript, pp.DoryParams, Commitment{
 			C:  C,
 			D1: A,
 			D2: rs.B,
-		}, rs.DoryProof1); err != nil {
-			atomicErr.Store(fmt.Errorf("first Dory proof invalid"))
-		}
-	}()
-
-	go func() {
-		defer wg.Done()
-
-		if err := VerifyReduce(pp.DoryParams, Commitment{
+		}, rs.DoryProof1)
+	}, func() {
+		sumProof = PrepareVerification(sumProofTranscript, pp.DoryParams, Commitment{
 			C:  E,
 			D1: pp.D,
 			D2: rs.B,
-		}, rs.DoryProof2); err != nil {
-			atomicErr.Store(fmt.Errorf("second Dory proof invalid"))
-		}
-	}()
+		}, rs.DoryProof2)
+	})
+
+	appendRingProofs(t, rs.DoryProof1, rs.DoryProof2)
+
+	return ringProof, sumProof, t
+}
+
+func (key PrivateKey) RingProof(pp PublicParams, ring Ring, r *math.Zr, com *math.G1) RingSignature {
+	return key.RingProofWithRand(rand.Reader, pp, ring, r, com)
+}
 
-	if err := rs.TagProof.Verify(rs.TagValue, rs.TagCommitment, prefix, m, rs.DoryProof1.Digest(), rs.DoryProof2.Digest()); err != nil {
-		atomicErr.Store(fmt.Errorf("tag proof invalid"))
+// RingProofWithRand is RingProof with randomness read from rnd.
+func (key PrivateKey) RingProofWithRand(rnd io.Reader, pp PublicParams, ring Ring, r *math.Zr, com *math.G1) RingSignature {
+	σ, err := key.tryRingProof(rnd, pp, ring, r, com)
+	if err != nil {
+		panic(err)
 	}
+	return σ
+}
 
-	wg.Wait()
+// TryRingProof is RingProof, but returns an error instead of panicking if the key is not in the ring,
+// or the ring or the public parameters are malformed.
+func (key PrivateKey) TryRingProof(pp PublicParams, ring Ring, r *math.Zr, com *math.G1) (RingSignature, error) {
+	return key.tryRingProof(rand.Reader, pp, ring, r, com)
+}
 
-	if atomicErr.Load() == nil {
-		return nil
+func (key PrivateKey) tryRingProof(rnd io.Reader, pp PublicParams, ring Ring, r *math.Zr, com *math.G1) (RingSignature, error) {
+	_, pkIndex, err := key.findPK(ring)
+	if err != nil {
+		return RingSignature{}, err
+	}
+	return ringProof(rnd, pp, ring, pkIndex, r, com, nil)
+}
+
+// check checks that the public parameters are consistent with each other, so that proofs can be made with them.
+func (pp PublicParams) check() error {
+	if err := CheckPublicParams(pp.DoryParams); err != nil {
+		return err
+	}
+
+	if pp.A0Inverse == nil || pp.D == nil || pp.Γ2 == nil {
+		return fmt.Errorf("%w: missing pre-processed parameters", ErrParamsMismatch)
 	}
 
-	return atomicErr.Load().(error)
+	if len(pp.H1) != len(pp.DoryParams[0].Γ1) {
+		return fmt.Errorf("%w: pre-processed parameters of size %d do not match Dory parameters of size %d", ErrParamsMismatch, len(pp.H1), len(pp.DoryParams[0].Γ1))
+	}
+
+	return nil
 }
 
-func (key PrivateKey) RingProof(pp PublicParams, ring Ring, r *math.Zr, com *math.G1) RingSignature {
+// ringProof proves that tagCommitment + weightCommitment - ring[pkIndex] = r H, without revealing pkIndex.
+// The weight commitment is nil unless the ring is weighted.
+func ringProof(rnd io.Reader, pp PublicParams, ring Ring, pkIndex int, r *math.Zr, tagCommitment *math.G1, weightCommitment *math.G1) (RingSignature, error) {
+	if err := pp.check(); err != nil {
+		return RingSignature{}, err
+	}
+
+	if len(ring) != pp.ringSize {
+		return RingSignature{}, fmt.Errorf("%w: ring of size %d does not match public parameters of a ring of size %d", ErrRingSizeMismatch, len(ring), pp.ringSize)
+	}
+
+	for i, pk := range ring {
+		if pk == nil {
+			return RingSignature{}, fmt.Errorf("ring member %d is missing", i)
+		}
+	}
+
+	com := ringCommitment(tagCommitment, weightCommitment)
+
+	ring = ring.Pad(len(pp.H1))
 	n := len(ring)
 
 	// Locally load public params
@@ -245,17 +1093,22 @@ func (key PrivateKey) RingProof(pp PublicParams, ring Ring, r *math.Zr, com *mat
 	A := e(com, Γ2)
 	A.Mul(A0Inverse)
 
-	y := curve.NewRandomZr(rand.Reader)
+	y, err := RandomZr(rnd)
+	if err != nil {
+		return RingSignature{}, err
+	}
 
 	c := make([]*math.Zr, n-1)
 	for i := 0; i < len(c); i++ {
-		c[i] = curve.NewRandomZr(rand.Reader)
+		if c[i], err = RandomZr(rnd); err != nil {
+			return RingSignature{}, err
+		}
 	}
 
-	_, pkIndex := key.locatePK(ring)
 	Y := computeY(y, c, com, ring, pkIndex)
 
-	h := hashToZr(A.Bytes(), Y.Bytes(), pp.digest)
+	t := ringTranscript(pp, tagCommitment, A, Y)
+	h := t.ChallengeZr("h")
 
 	cj := h.Plus(negZr(sumZr(c...)))
 	cj.Mod(curve.GroupOrder)
@@ -267,7 +1120,7 @@ func (key PrivateKey) RingProof(pp PublicParams, ring Ring, r *math.Zr, com *mat
 
 	cSum := sumZr(c...)
 	if !cSum.Equals(h) {
-		panic("sum of c isn't h")
+		return RingSignature{}, fmt.Errorf("sum of c isn't h")
 	}
 
 	G2c := G2v{curve.GenG2}.Duplicate(n).Mulv(c)
@@ -277,7 +1130,7 @@ func (key PrivateKey) RingProof(pp PublicParams, ring Ring, r *math.Zr, com *mat
 	C := e(h1zByY, curve.GenG2)
 
 	E := e(H().Mul(h), curve.GenG2)
-	B := dpp.Γ1.InnerProd(G2c)
+	B := dpp.Executor().InnerProd(dpp.Γ1, G2c)
 
 	cmt1 := Commitment{
 		C:  C,
@@ -301,65 +1154,183 @@ func (key PrivateKey) RingProof(pp PublicParams, ring Ring, r *math.Zr, com *mat
 		V2: G2c,
 	}
 
-	var π1 Proof
+	var π1, π2 Proof
 
-	var wg sync.WaitGroup
-	wg.Add(1)
+	ringProofTranscript, sumProofTranscript := t.Fork("ring"), t.Fork("sum")
 
-	go func() {
-		defer wg.Done()
-		π1 = Reduce(pp.DoryParams, w1, cmt1)
-	}()
-
-	π2 := Reduce(pp.DoryParams, w2, cmt2)
+	executorOf(pp.DoryParams).Parallel(func() {
+		π1 = ReduceWithTranscript(ringProofTranscript, pp.DoryParams, w1, cmt1)
+	}, func() {
+		π2 = ReduceWithTranscript(sumProofTranscript, pp.DoryParams, w2, cmt2)
+	})
 
-	wg.Wait()
+	appendRingProofs(t, π1, π2)
 
 	return RingSignature{
-		TagCommitment: com,
-		DoryProof1:    π1,
-		DoryProof2:    π2,
-		Z:             z,
-		Y:             Y,
-		B:             B,
-	}
+		transcript:       t,
+		TagCommitment:    tagCommitment,
+		WeightCommitment: weightCommitment,
+		DoryProof1:       π1,
+		DoryProof2:       π2,
+		Z:                z,
+		Y:                Y,
+		B:                B,
+	}, nil
 }
 
 func (key PrivateKey) PreProcessRingProof(pp PublicParams, ring Ring) (r *math.Zr, σ RingSignature) {
+	return key.PreProcessRingProofWithRand(rand.Reader, pp, ring)
+}
+
+// PreProcessRingProofWithRand is PreProcessRingProof with randomness read from rnd.
+func (key PrivateKey) PreProcessRingProofWithRand(rnd io.Reader, pp PublicParams, ring Ring) (r *math.Zr, σ RingSignature) {
+	r, σ, err := key.tryPreProcessRingProof(rnd, pp, ring)
+	if err != nil {
+		panic(err)
+	}
+	return r, σ
+}
+
+// TryPreProcessRingProof is PreProcessRingProof, but returns an error instead of panicking.
+func (key PrivateKey) TryPreProcessRingProof(pp PublicParams, ring Ring) (*math.Zr, RingSignature, error) {
+	return key.tryPreProcessRingProof(rand.Reader, pp, ring)
+}
+
+func (key PrivateKey) tryPreProcessRingProof(rnd io.Reader, pp PublicParams, ring Ring) (*math.Zr, RingSignature, error) {
 	sk := math.Zr(key)
-	w, c := tag.Commit(&sk)
+	w, c, err := tag.TryCommitWithRand(rnd, &sk)
+	if err != nil {
+		return nil, RingSignature{}, err
+	}
+
+	σ, err := key.tryRingProof(rnd, pp, ring, &w.R, c)
+	if err != nil {
+		return nil, RingSignature{}, err
+	}
 
-	r = &w.R
-	σ = key.RingProof(pp, ring, r, c)
+	return &w.R, σ, nil
+}
 
-	return
+// AppendTagProof completes a ring proof produced by RingProof or PreProcessRingProof into a signature on m.
+// If the ring proof went through serialization, its transcript is rebuilt from its public fields and the public parameters.
+func (key PrivateKey) AppendTagProof(pp PublicParams, σ *RingSignature, r *math.Zr, m []byte, prefix []byte) error {
+	return key.AppendTagProofWithRand(rand.Reader, pp, σ, r, m, prefix)
 }
 
-func (key PrivateKey) AppendTagProof(σ *RingSignature, r *math.Zr, m []byte, prefix []byte) {
+// AppendTagProofWithRand is AppendTagProof with randomness read from rnd.
+func (key PrivateKey) AppendTagProofWithRand(rnd io.Reader, pp PublicParams, σ *RingSignature, r *math.Zr, m []byte, prefix []byte) error {
 	sk := math.Zr(key)
 
-	πt := tag.NewProof(prefix, &sk, &tag.Witness{R: *r}, m, σ.DoryProof1.Digest(), σ.DoryProof2.Digest())
+	if σ.transcript == nil {
+		if err := checkRingProof(pp, σ.TagCommitment, σ.B, σ.Z, σ.Y, σ.DoryProof1, σ.DoryProof2); err != nil {
+			return err
+		}
+		σ.transcript = σ.rebuildTranscript(pp)
+	}
+
+	πt, err := tag.TryNewProofWithRand(rnd, tagTranscript(σ.transcript, m), prefix, &sk, &tag.Witness{R: *r})
+	if err != nil {
+		return err
+	}
 	t := tag.Tag(&sk, prefix)
 
 	σ.TagValue = t
 	σ.TagProof = πt
+
+	return nil
 }
 
 func (key PrivateKey) Sign(pp PublicParams, m []byte, prefix []byte, ring Ring) RingSignature {
+	return key.SignWithRand(rand.Reader, pp, m, prefix, ring)
+}
+
+// TrySign is Sign, but returns an error instead of panicking if the key is not in the ring,
+// or the ring or the public parameters are malformed.
+func (key PrivateKey) TrySign(pp PublicParams, m []byte, prefix []byte, ring Ring) (RingSignature, error) {
+	return key.TrySignWithRand(rand.Reader, pp, m, prefix, ring)
+}
+
+// SignWithRand signs like Sign, with all randomness read from rnd.
+func (key PrivateKey) SignWithRand(rnd io.Reader, pp PublicParams, m []byte, prefix []byte, ring Ring) RingSignature {
+	σ, err := key.TrySignWithRand(rnd, pp, m, prefix, ring)
+	if err != nil {
+		panic(err)
+	}
+	return σ
+}
+
+// TrySignWithRand is SignWithRand, but returns an error instead of panicking,
+// in particular if rnd fails to provide randomness.
+func (key PrivateKey) TrySignWithRand(rnd io.Reader, pp PublicParams, m []byte, prefix []byte, ring Ring) (RingSignature, error) {
 	sk := math.Zr(key)
-	r, com := tag.Commit(&sk)
+	r, com, err := tag.TryCommitWithRand(rnd, &sk)
+	if err != nil {
+		return RingSignature{}, err
+	}
 
-	σ := key.RingProof(pp, ring, &r.R, com)
+	_, pkIndex, err := key.findPK(ring)
+	if err != nil {
+		return RingSignature{}, err
+	}
+
+	σ, err := ringProof(rnd, pp, ring, pkIndex, &r.R, com, nil)
+	if err != nil {
+		return RingSignature{}, err
+	}
 
-	πt := tag.NewProof(prefix, &sk, r, m, σ.DoryProof1.Digest(), σ.DoryProof2.Digest())
+	πt, err := tag.TryNewProofWithRand(rnd, tagTranscript(σ.transcript, m), prefix, &sk, r)
+	if err != nil {
+		return RingSignature{}, err
+	}
 	t := tag.Tag(&sk, prefix)
 
 	σ.TagValue = t
 	σ.TagProof = πt
 
+	return σ, nil
+}
+
+// SignHedged signs like Sign, but derives all of its nonces from the key, the public parameters, the ring,
+// the message, the prefix and the optional entropy, so that a faulty random number generator cannot leak the key.
+// Without entropy, signing the same message twice results in the same signature.
+func (key PrivateKey) SignHedged(pp PublicParams, m []byte, prefix []byte, ring Ring, entropy []byte) RingSignature {
+	σ, err := key.TrySignHedged(pp, m, prefix, ring, entropy)
+	if err != nil {
+		panic(err)
+	}
 	return σ
 }
 
+// TrySignHedged is SignHedged, but returns an error instead of panicking if the key is not in the ring,
+// or the ring or the public parameters are malformed.
+func (key PrivateKey) TrySignHedged(pp PublicParams, m []byte, prefix []byte, ring Ring, entropy []byte) (RingSignature, error) {
+	_, pkIndex, err := key.findPK(ring)
+	if err != nil {
+		return RingSignature{}, err
+	}
+
+	return key.TrySignWithRand(key.nonceReader(pp, ring, pkIndex, m, prefix, entropy), pp, m, prefix, ring)
+}
+
+// nonceReader derives the nonces of a signature. The ring and the index of the signer are part of the seed,
+// as the public parameters are not checked against the ring: signing the same message under the same parameters
+// with two rings of the same size would otherwise reuse the nonces under distinct challenges, which reveals the key.
+func (key PrivateKey) nonceReader(pp PublicParams, ring Ring, pkIndex int, m, prefix, entropy []byte) *NonceReader {
+	sk := math.Zr(key)
+
+	var keys []byte
+	for _, pk := range ring {
+		if pk != nil {
+			keys = append(keys, pk.Bytes()...)
+		}
+	}
+
+	index := make([]byte, 8)
+	binary.BigEndian.PutUint64(index, uint64(pkIndex))
+
+	return NewNonceReader(sk.Bytes(), []byte(RingSignatureLabel), pp.digest, keys, index, m, prefix, entropy)
+}
+
 func negZr(x *math.Zr) *math.Zr {
 	zero := curve.NewZrFromInt(0)
 	return curve.ModSub(zero, x, curve.GroupOrder)
@@ -412,11 +1383,41 @@ func e(g1 *math.G1, g2 *math.G2) *math.Gt {
 	return curve.FExp(gt)
 }
 
-func hashToZr(in ...[]byte) *math.Zr {
-	h := sha256.New()
-	for _, bytes := range in {
-		h.Write(bytes)
-	}
-	digest := h.Sum(nil)
-	return FieldElementFromBytes(digest)
+// ringStatement returns A, the pairing of the commitment of the signature with the Dory parameters,
+// divided by the pairing of the ring with them.
+func (rs RingSignature) ringStatement(pp PublicParams) *math.Gt {
+	A := e(ringCommitment(rs.TagCommitment, rs.WeightCommitment), pp.Γ2)
+	A.Mul(pp.A0Inverse)
+	return A
+}
+
+// rebuildTranscript recomputes the transcript of the signature after both ring proofs are appended to it.
+func (rs RingSignature) rebuildTranscript(pp PublicParams) *Transcript {
+	t := ringTranscript(pp, rs.TagCommitment, rs.ringStatement(pp), rs.Y)
+	t.ChallengeZr("h")
+	appendRingProofs(t, rs.DoryProof1, rs.DoryProof2)
+	return t
+}
+
+// ringTranscript starts the transcript of a ring signature, from which the ring challenge h is derived.
+// The two Dory proofs are then made on forks of it, and the tag proof on a fork of it after
+// both Dory proofs are appended, so that the signature is bound end to end.
+func ringTranscript(pp PublicParams, com *math.G1, A *math.Gt, Y *math.G1) *Transcript {
+	t := NewTranscript(RingSignatureLabel)
+	t.AppendBytes("pp", pp.digest)
+	t.AppendG1("commitment", com)
+	t.AppendGt("A", A)
+	t.AppendG1("Y", Y)
+	return t
+}
+
+func appendRingProofs(t *Transcript, π1, π2 Proof) {
+	t.AppendBytes("ring proof", π1.Digest())
+	t.AppendBytes("sum proof", π2.Digest())
+}
+
+func tagTranscript(t *Transcript, m []byte) *Transcript {
+	tt := t.Fork("tag")
+	tt.AppendBytes("message", m)
+	return tt
 }
@@ -8,13 +8,49 @@ package threshold
 
 import (
 	"crypto/rand"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"io"
+	mrand "math/rand"
+	"os"
+	"path/filepath"
+	"privacy-perserving-audit/common"
 	"privacy-perserving-audit/dory"
+	"privacy-perserving-audit/tag"
+	"strings"
 	"testing"
 
 	math "github.com/IBM/mathlib"
 	"github.com/stretchr/testify/assert"
 )
 
+var (
+	msg    = []byte("message")
+	prefix = []byte{1, 2, 3}
+)
+
+// newTestRing generates a ring of n fresh keys, along with public parameters for it.
+func newTestRing(t *testing.T, n int) (Ring, []PrivateKey, PublicParams) {
+	t.Helper()
+
+	var ring Ring
+	var sks []PrivateKey
+	for i := 0; i < n; i++ {
+		pk, sk := KeyGen()
+		ring = append(ring, (*math.G1)(&pk))
+		sks = append(sks, sk)
+	}
+
+	pps := dory.GeneratePublicParams(n)
+	pp := PublicParams{
+		DoryParams:         pps,
+		PreProcessedParams: ComputePreProcessedParams(pps, ring),
+	}
+
+	return ring, sks, pp
+}
+
 func TestThresholdRingSignature(t *testing.T) {
 	pk1, sk1 := KeyGen()
 	pk2, sk2 := KeyGen()
@@ -47,3 +83,536 @@ func TestThresholdRingSignature(t *testing.T) {
 	assert.EqualError(t, err, "signature set was signed by 1 out of 2 distinct signers")
 
 }
+
+func TestSignatureFromBytes(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 2)
+
+	σ := sks[0].Sign(pp, msg, prefix, ring)
+	raw := σ.Bytes()
+
+	σ2, err := SignatureFromBytes(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, σ2.Bytes())
+	assert.NoError(t, σ2.Verify(pp, msg, prefix))
+
+	_, err = SignatureFromBytes(append(raw, 0))
+	assert.EqualError(t, err, "trailing bytes after signature")
+
+	tampered := σ
+	tampered.Y = σ.TagValue
+	σ3, err := SignatureFromBytes(tampered.Bytes())
+	assert.NoError(t, err)
+	assert.Error(t, σ3.Verify(pp, msg, prefix))
+
+	ss := SerializedSignature{
+		TagProof:      σ.TagProof.Bytes(),
+		TagCommitment: σ.TagCommitment.Bytes(),
+		TagValue:      σ.TagValue.Bytes(),
+		DoryProof1:    σ.DoryProof1.Bytes(),
+		DoryProof2:    σ.DoryProof2.Bytes(),
+		B:             σ.B.Bytes(),
+		Z:             σ.Z.Bytes(),
+		Y:             σ.Y.Bytes(),
+	}
+	// Flip a coordinate so that Y is no longer on the curve
+	ss.Y[len(ss.Y)-1] ^= 1
+	malformed, err := asn1.Marshal(ss)
+	assert.NoError(t, err)
+	_, err = SignatureFromBytes(malformed)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid Y")
+}
+
+func TestPublicParamsFromBytes(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 2)
+
+	raw := pp.Bytes()
+	loaded, err := PublicParamsFromBytes(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, raw, loaded.Bytes())
+
+	σ := sks[0].Sign(loaded, msg, prefix, ring)
+	assert.NoError(t, σ.Verify(pp, msg, prefix))
+
+	otherRing := Ring{ring[1], ring[0]}
+	other := PublicParams{
+		DoryParams:         pp.DoryParams,
+		PreProcessedParams: ComputePreProcessedParams(pp.DoryParams, otherRing),
+	}
+	other.digest = pp.digest
+	_, err = PublicParamsFromBytes(other.Bytes())
+	assert.EqualError(t, err, "pre-processed parameters digest mismatch")
+
+	// Parameters written by versions 1 and 2 load as those of epoch 0
+	old := func(version int, digest []byte) []byte {
+		bytes, err := asn1.Marshal(struct {
+			Version            int
+			DoryParams         []byte
+			PreProcessedParams struct {
+				Digest, A0Inverse, D, Γ2 []byte
+				RingSize                 int
+			}
+		}{
+			Version:    version,
+			DoryParams: dory.PPsBytes(pp.DoryParams),
+			PreProcessedParams: struct {
+				Digest, A0Inverse, D, Γ2 []byte
+				RingSize                 int
+			}{
+				Digest:    digest,
+				A0Inverse: pp.A0Inverse.Bytes(),
+				D:         pp.D.Bytes(),
+				Γ2:        pp.Γ2.Bytes(),
+				RingSize:  pp.ringSize,
+			},
+		})
+		assert.NoError(t, err)
+		return bytes
+	}
+
+	for version, digest := range map[int][]byte{
+		1: pp.computeDigestV1(pp.DoryParams),
+		2: pp.computeDigestV2(pp.DoryParams),
+	} {
+		loaded, err = PublicParamsFromBytes(old(version, digest))
+		assert.NoError(t, err)
+		assert.Equal(t, pp.Digest(), loaded.Digest())
+		assert.Equal(t, uint64(0), loaded.Epoch())
+		assert.NoError(t, σ.Verify(loaded, msg, prefix))
+
+		_, err = PublicParamsFromBytes(old(version, pp.digest))
+		assert.EqualError(t, err, "pre-processed parameters digest mismatch")
+	}
+
+	var rpp RawPublicParams
+	_, err = asn1.Unmarshal(raw, &rpp)
+	assert.NoError(t, err)
+	rpp.Version = 4
+	future, err := asn1.Marshal(rpp)
+	assert.NoError(t, err)
+	_, err = PublicParamsFromBytes(future)
+	assert.EqualError(t, err, "unsupported public parameters version 4")
+}
+
+// The fixtures were written by version 1 of PublicParams.Bytes() for a ring whose i-th secret key is i+1,
+// before and after padding was introduced, which also added the ring size to the digest.
+func TestPublicParamsFixtures(t *testing.T) {
+	for fixture, size := range map[string]int{"public_params_v1.hex": 4, "public_params_v1_padded.hex": 3} {
+		encoded, err := os.ReadFile(filepath.Join("testdata", fixture))
+		assert.NoError(t, err)
+		raw, err := hex.DecodeString(strings.TrimSpace(string(encoded)))
+		assert.NoError(t, err)
+
+		pp, err := PublicParamsFromBytes(raw)
+		assert.NoError(t, err)
+		assert.Equal(t, size, pp.RingSize())
+		assert.Equal(t, uint64(0), pp.Epoch())
+
+		var ring Ring
+		var sks []PrivateKey
+		for i := 0; i < size; i++ {
+			sk := curve.NewZrFromInt(int64(i + 1))
+			ring = append(ring, curve.GenG1.Mul(sk))
+			sks = append(sks, PrivateKey(*sk))
+		}
+		assert.True(t, pp.A0Inverse.Equals(ComputePreProcessedParams(pp.DoryParams, ring).A0Inverse))
+
+		σ := sks[size-1].Sign(pp, msg, prefix, ring)
+		assert.NoError(t, σ.Verify(pp, msg, prefix))
+
+		reloaded, err := PublicParamsFromBytes(pp.Bytes())
+		assert.NoError(t, err)
+		assert.Equal(t, pp.Digest(), reloaded.Digest())
+
+		raw[len(raw)-1] ^= 1
+		_, err = PublicParamsFromBytes(raw)
+		assert.Error(t, err)
+	}
+}
+
+func TestNonPowerOfTwoRing(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 3)
+	assert.Len(t, pp.DoryParams[0].Γ1, 4)
+	assert.Equal(t, 3, pp.RingSize())
+
+	σ1 := sks[0].Sign(pp, msg, prefix, ring)
+	σ3 := sks[2].Sign(pp, msg, prefix, ring)
+	assert.NoError(t, VerifyThresholdSignatures(pp, msg, prefix, σ1, σ3))
+
+	// A padded ring of a different size yields different parameters
+	padded := PublicParams{
+		DoryParams:         pp.DoryParams,
+		PreProcessedParams: ComputePreProcessedParams(pp.DoryParams, ring.Pad(4)),
+	}
+	assert.True(t, padded.A0Inverse.Equals(pp.A0Inverse))
+	assert.NotEqual(t, padded.digest, pp.digest)
+	assert.Error(t, σ1.Verify(padded, msg, prefix))
+
+	assert.Panics(t, func() {
+		sks[0].Sign(pp, msg, prefix, ring[:2])
+	})
+}
+
+func TestLink(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 2)
+
+	σ1 := sks[0].Sign(pp, msg, prefix, ring)
+	σ2 := sks[1].Sign(pp, msg, prefix, ring)
+	σ3 := sks[0].Sign(pp, msg, prefix, ring)
+	σ4 := sks[0].Sign(pp, msg, []byte{4, 5, 6}, ring)
+
+	assert.True(t, Link(σ1, σ3))
+	assert.False(t, Link(σ1, σ2))
+	assert.False(t, Link(σ1, σ4))
+
+	linked := LinkAll([]RingSignature{σ1, σ2, σ3})
+	assert.Len(t, linked, 2)
+	assert.Equal(t, []int{0, 2}, linked[string(σ1.TagValue.Bytes())])
+	assert.Equal(t, []int{1}, linked[string(σ2.TagValue.Bytes())])
+
+	err := VerifyThresholdSignatures(pp, msg, prefix, σ1, σ2, σ3)
+	var linkedErr *LinkedSignaturesError
+	assert.True(t, errors.As(err, &linkedErr))
+	assert.Equal(t, [][]int{{0, 2}}, linkedErr.Linked)
+	assert.EqualError(t, err, "signature set was signed by 2 out of 3 distinct signers")
+}
+
+func TestVerifyBatch(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 4)
+
+	var signatures []RingSignature
+	for _, sk := range sks {
+		signatures = append(signatures, sk.Sign(pp, msg, prefix, ring))
+	}
+
+	assert.NoError(t, VerifyBatch(pp, msg, prefix, signatures...))
+	assert.NoError(t, VerifyBatch(pp, msg, prefix))
+
+	signatures[1] = sks[1].Sign(pp, []byte("another message"), prefix, ring)
+	signatures[3].Z = signatures[2].Z
+
+	err := VerifyBatch(pp, msg, prefix, signatures...)
+	var batchErr *BatchVerificationError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, []int{1, 3}, batchErr.Invalid)
+	assert.EqualError(t, err, "2 out of 4 signatures are invalid: [1 3]")
+}
+
+func TestUpdatePreProcessedParams(t *testing.T) {
+	var ring Ring
+	var sks []PrivateKey
+	for i := 0; i < 5; i++ {
+		pk, sk := KeyGen()
+		ring = append(ring, (*math.G1)(&pk))
+		sks = append(sks, sk)
+	}
+
+	pps := dory.GeneratePublicParams(4)
+	ppp := ComputePreProcessedParams(pps, ring[:3])
+	assert.Equal(t, uint64(0), ppp.Epoch())
+
+	// Replace the second key, append a key, and remove the first key
+	updated, newRing, err := UpdatePreProcessedParams(pps, ppp, ring[:3],
+		RingChange{Index: 1, Key: ring[3]},
+		RingChange{Index: 3, Key: ring[4]},
+		RingChange{Index: 0},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, Ring{ring[4], ring[3], ring[2]}, newRing)
+	assert.Equal(t, uint64(1), updated.Epoch())
+	assert.Equal(t, 3, updated.RingSize())
+
+	recomputed := ComputePreProcessedParams(pps, newRing)
+	assert.True(t, recomputed.A0Inverse.Equals(updated.A0Inverse))
+	assert.NotEqual(t, recomputed.Digest(), updated.Digest())
+
+	// Verifiers applying the same changes arrive at the same digest
+	again, _, err := UpdatePreProcessedParams(pps, ppp, ring[:3],
+		RingChange{Index: 1, Key: ring[3]},
+		RingChange{Index: 3, Key: ring[4]},
+		RingChange{Index: 0},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, updated.Digest(), again.Digest())
+
+	pp := PublicParams{
+		DoryParams:         pps,
+		PreProcessedParams: updated,
+	}
+
+	σ := sks[4].Sign(pp, msg, prefix, newRing)
+	assert.NoError(t, σ.Verify(pp, msg, prefix))
+
+	old := sks[2].Sign(PublicParams{DoryParams: pps, PreProcessedParams: ppp}, msg, prefix, ring[:3])
+	assert.Error(t, old.Verify(pp, msg, prefix))
+
+	loaded, err := PublicParamsFromBytes(pp.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, updated.Digest(), loaded.Digest())
+	assert.Equal(t, uint64(1), loaded.Epoch())
+
+	_, _, err = UpdatePreProcessedParams(pps, ppp, ring[:2])
+	assert.EqualError(t, err, "ring of size 2 does not match pre-processed parameters of a ring of size 3")
+
+	_, _, err = UpdatePreProcessedParams(pps, ppp, ring[:3], RingChange{Index: 3})
+	assert.EqualError(t, err, "index 3 out of range for a ring of size 3")
+
+	_, _, err = UpdatePreProcessedParams(pps, updated, newRing, RingChange{Index: 3, Key: ring[0]}, RingChange{Index: 4, Key: ring[1]})
+	assert.EqualError(t, err, "ring is full, Dory parameters support only 4 keys")
+}
+
+func TestSignWithRand(t *testing.T) {
+	pk, _ := KeyGenFrom(mrand.New(mrand.NewSource(1)))
+	again, _ := KeyGenFrom(mrand.New(mrand.NewSource(1)))
+	assert.Equal(t, (*math.G1)(&pk).Bytes(), (*math.G1)(&again).Bytes())
+	assert.Equal(t, "154e442976a91f4bc1db477159d7dc17cd10703759879402c7bea6cf0edf14672de03940e6f9ce45ec2e52467fff028d95b971cf0c2db545ca5fb457e87d4262", hex.EncodeToString((*math.G1)(&pk).Bytes()))
+
+	ring, sks, pp := newTestRing(t, 2)
+
+	σ1 := sks[0].SignWithRand(mrand.New(mrand.NewSource(3)), pp, msg, prefix, ring)
+	σ2 := sks[0].SignWithRand(mrand.New(mrand.NewSource(3)), pp, msg, prefix, ring)
+	assert.NoError(t, σ1.Verify(pp, msg, prefix))
+	assert.Equal(t, σ1.Bytes(), σ2.Bytes())
+
+	σ3 := sks[0].SignWithRand(mrand.New(mrand.NewSource(4)), pp, msg, prefix, ring)
+	assert.NoError(t, σ3.Verify(pp, msg, prefix))
+	assert.NotEqual(t, σ1.Bytes(), σ3.Bytes())
+}
+
+func TestSignVariantsWithRand(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 3)
+
+	opener, openerKey := OpenerKeyGenFrom(mrand.New(mrand.NewSource(1)))
+	again, _ := OpenerKeyGenFrom(mrand.New(mrand.NewSource(1)))
+	assert.Equal(t, (*math.G1)(&opener).Bytes(), (*math.G1)(&again).Bytes())
+
+	tp := ComputeThresholdParams(dory.GeneratePublicParams(ThresholdDorySize(len(ring), 2)), ring, 2)
+
+	for name, sign := range map[string]func(rnd *mrand.Rand) []byte{
+		"traceable": func(rnd *mrand.Rand) []byte {
+			return sks[0].SignTraceableWithRand(rnd, pp, msg, prefix, ring).Bytes()
+		},
+		"accountable": func(rnd *mrand.Rand) []byte {
+			return sks[0].SignAccountableWithRand(rnd, pp, msg, prefix, ring, opener).Bytes()
+		},
+		"unlinkable": func(rnd *mrand.Rand) []byte {
+			return sks[0].SignUnlinkableWithRand(rnd, pp, msg, ring).Bytes()
+		},
+		"pre-processed": func(rnd *mrand.Rand) []byte {
+			r, σ := sks[0].PreProcessRingProofWithRand(rnd, pp, ring)
+			assert.NoError(t, sks[0].AppendTagProofWithRand(rnd, pp, &σ, r, msg, prefix))
+			return σ.Bytes()
+		},
+		"same signer": func(rnd *mrand.Rand) []byte {
+			r1, σ1 := sks[0].PreProcessRingProofWithRand(rnd, pp, ring)
+			r2, σ2 := sks[0].PreProcessRingProofWithRand(rnd, pp, ring)
+			return ProveSameSignerWithRand(rnd, σ1, r1, σ2, r2).Bytes()
+		},
+		"opening": func(rnd *mrand.Rand) []byte {
+			σ := sks[0].SignAccountableWithRand(rnd, pp, msg, prefix, ring, opener)
+			_, π, err := OpenWithRand(rnd, openerKey, ring, σ)
+			assert.NoError(t, err)
+			return append(π.A1.Bytes(), π.S.Bytes()...)
+		},
+		"threshold": func(rnd *mrand.Rand) []byte {
+			return SignThresholdWithRand(rnd, tp, msg, prefix, ring, sks[0], sks[1]).Bytes()
+		},
+	} {
+		assert.Equal(t, sign(mrand.New(mrand.NewSource(2))), sign(mrand.New(mrand.NewSource(2))), name)
+		assert.NotEqual(t, sign(mrand.New(mrand.NewSource(2))), sign(mrand.New(mrand.NewSource(3))), name)
+	}
+}
+
+func TestSignHedged(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 2)
+
+	σ1 := sks[0].SignHedged(pp, msg, prefix, ring, nil)
+	σ2 := sks[0].SignHedged(pp, msg, prefix, ring, nil)
+	assert.NoError(t, σ1.Verify(pp, msg, prefix))
+	assert.Equal(t, σ1.Bytes(), σ2.Bytes())
+
+	// Nonces differ across messages, prefixes and entropy
+	for _, σ := range []RingSignature{
+		sks[0].SignHedged(pp, []byte("another message"), prefix, ring, nil),
+		sks[0].SignHedged(pp, msg, []byte{4, 5, 6}, ring, nil),
+		sks[0].SignHedged(pp, msg, prefix, ring, []byte{7}),
+	} {
+		assert.False(t, σ.Y.Equals(σ1.Y))
+		assert.False(t, σ.TagCommitment.Equals(σ1.TagCommitment))
+	}
+
+	σ3 := sks[0].SignHedged(pp, msg, prefix, ring, []byte{7})
+	assert.NoError(t, σ3.Verify(pp, msg, prefix))
+
+	// Nonces differ across rings of the same size under the same parameters, which are not checked against the ring,
+	// as otherwise the responses under two distinct challenges would reveal the key
+	pk, _ := KeyGen()
+	for _, other := range []Ring{{ring[0], (*math.G1)(&pk)}, {ring[1], ring[0]}} {
+		σ, err := sks[0].TrySignHedged(pp, msg, prefix, other, nil)
+		assert.NoError(t, err)
+		assert.False(t, σ.Y.Equals(σ1.Y))
+		assert.False(t, σ.TagCommitment.Equals(σ1.TagCommitment))
+	}
+
+	_, outsider := KeyGen()
+	_, err := outsider.TrySignHedged(pp, msg, prefix, ring, nil)
+	assert.True(t, errors.Is(err, ErrNotInRing))
+
+	// The nonces of a fixed key and context are pinned
+	key := PrivateKey(*curve.NewZrFromInt(42))
+	nr := key.nonceReader(PublicParams{PreProcessedParams: PreProcessedParams{digest: []byte("digest")}}, Ring{curve.GenG1}, 0, msg, prefix, nil)
+	assert.Equal(t, "19d51a9963843dd49a2a961f34ede1672f3217702bf0f78b39ee2cc2064aedf1", hex.EncodeToString(common.MustRandomZr(nr).Bytes()))
+	assert.Equal(t, "0b569e562dcda640bd73f5e995bd0dace8802aacc718dcbfe7e10c9c77c19325", hex.EncodeToString(common.MustRandomZr(nr).Bytes()))
+}
+
+func TestTrySign(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 2)
+	_, outsider := KeyGen()
+
+	σ, err := sks[0].TrySign(pp, msg, prefix, ring)
+	assert.NoError(t, err)
+	assert.NoError(t, σ.Verify(pp, msg, prefix))
+
+	// A source of randomness that runs dry fails the commitment, the ring proof and the tag proof
+	for _, n := range []int64{10, 100, 200} {
+		_, err = sks[0].TrySignWithRand(io.LimitReader(rand.Reader, n), pp, msg, prefix, ring)
+		assert.EqualError(t, err, "failed reading randomness: unexpected EOF")
+	}
+	_, err = outsider.TrySign(pp, msg, prefix, ring)
+	assert.True(t, errors.Is(err, ErrNotInRing))
+
+	_, _, err = outsider.TryPreProcessRingProof(pp, ring)
+	assert.True(t, errors.Is(err, ErrNotInRing))
+
+	_, err = sks[0].TrySign(pp, msg, prefix, Ring{ring[0]})
+	assert.True(t, errors.Is(err, ErrRingSizeMismatch))
+
+	_, err = sks[0].TrySign(pp, msg, prefix, Ring{ring[0], nil})
+	assert.EqualError(t, err, "ring member 1 is missing")
+
+	// Pre-processed parameters that do not match the Dory parameters
+	mismatched := PublicParams{
+		DoryParams:         dory.GeneratePublicParams(4),
+		PreProcessedParams: pp.PreProcessedParams,
+	}
+	_, err = sks[0].TrySign(mismatched, msg, prefix, ring)
+	assert.True(t, errors.Is(err, dory.ErrParamsMismatch))
+
+	_, _, err = sks[0].TryPreProcessRingProof(PublicParams{}, ring)
+	assert.True(t, errors.Is(err, dory.ErrParamsMismatch))
+
+	_, err = sks[0].TryRingProof(mismatched, ring, curve.NewZrFromInt(1), σ.TagCommitment)
+	assert.True(t, errors.Is(err, dory.ErrParamsMismatch))
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 4)
+
+	σ := sks[0].Sign(pp, msg, prefix, ring)
+	assert.NoError(t, σ.Validate(pp))
+
+	truncated := σ
+	truncated.DoryProof1.Step1Elements = truncated.DoryProof1.Step1Elements[:1]
+	truncated.DoryProof1.Step2Elements = truncated.DoryProof1.Step2Elements[:1]
+	err := truncated.Verify(pp, msg, prefix)
+	assert.True(t, errors.Is(err, dory.ErrParamsMismatch))
+
+	missing := σ
+	missing.DoryProof2.Step2Elements = append([]dory.ReduceProverStep2Elements(nil), σ.DoryProof2.Step2Elements...)
+	missing.DoryProof2.Step2Elements[1].Cplus = nil
+	assert.EqualError(t, missing.Verify(pp, msg, prefix), "malformed signature: invalid second Dory proof: malformed proof: round 1 is incomplete")
+
+	noE1 := σ
+	noE1.DoryProof1.ScalarProductProofElements.E1 = nil
+	assert.EqualError(t, noE1.Verify(pp, msg, prefix), "malformed signature: invalid first Dory proof: malformed proof: E1, E2 should be of size 1")
+
+	identityTag := σ
+	identityTag.TagValue = curve.NewG1()
+	assert.EqualError(t, identityTag.Verify(pp, msg, prefix), "malformed signature: invalid tag: identity element")
+
+	noZ := σ
+	noZ.Z = nil
+	assert.EqualError(t, noZ.Verify(pp, msg, prefix), "malformed signature: invalid Z: missing scalar")
+
+	noB := σ
+	noB.B = nil
+	assert.EqualError(t, noB.Verify(pp, msg, prefix), "malformed signature: invalid B: missing Gt element")
+
+	noTagProof := σ
+	noTagProof.TagProof = tag.Proof{}
+	assert.EqualError(t, noTagProof.Verify(pp, msg, prefix), "malformed signature: invalid tag proof: invalid A: missing G1 element")
+
+	// Verify only checks the shape of a signature, Validate also checks subgroup membership
+	for _, malformed := range []RingSignature{missing, noE1, identityTag, noZ, noB, noTagProof} {
+		assert.EqualError(t, malformed.Validate(pp), malformed.Verify(pp, msg, prefix).Error())
+	}
+
+	err = VerifyBatch(pp, msg, prefix, σ, truncated, identityTag, sks[1].Sign(pp, msg, prefix, ring))
+	var batchErr *BatchVerificationError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, []int{1, 2}, batchErr.Invalid)
+
+	us := sks[2].SignUnlinkable(pp, msg, ring)
+	us.Y = nil
+	assert.EqualError(t, us.VerifyUnlinkable(pp, msg), "malformed signature: invalid Y: missing G1 element")
+}
+
+func TestWithWorkers(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 4)
+	tp := ComputeThresholdParams(dory.GeneratePublicParams(ThresholdDorySize(len(ring), 2)), ring, 2)
+
+	for _, n := range []int{0, 1} {
+		workers := WithWorkers(n)
+		pp, tp := pp.With(workers), tp.With(workers)
+
+		// The workers are shared by the public parameters and all levels of their Dory public parameters
+		executor := pp.DoryParams[0].Executor()
+		assert.Equal(t, n, executor.Workers())
+		for _, dpp := range append(pp.DoryParams, tp.DoryParams...) {
+			assert.True(t, executor == dpp.Executor())
+		}
+
+		var signatures []RingSignature
+		for _, sk := range sks {
+			signatures = append(signatures, sk.Sign(pp, msg, prefix, ring))
+		}
+
+		assert.NoError(t, VerifyThresholdSignatures(pp, msg, prefix, signatures...))
+		assert.NoError(t, VerifyBatch(pp, msg, prefix, signatures...))
+
+		ts := SignThreshold(tp, msg, prefix, ring, sks[0], sks[1])
+		assert.NoError(t, ts.Verify(tp, msg, prefix))
+	}
+
+	// The public parameters the options are applied to are left as they are
+	assert.Nil(t, pp.DoryParams[0].Executor())
+	assert.Nil(t, tp.DoryParams[0].Executor())
+}
+
+func TestAppendTagProofToStoredRingProof(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 2)
+
+	r, σ := sks[0].PreProcessRingProof(pp, ring)
+
+	// The ring proof is stored before the message is known, which loses its transcript
+	stored, err := SignatureFromBytes(σ.Bytes())
+	assert.NoError(t, err)
+	assert.Nil(t, stored.TagValue)
+
+	assert.NoError(t, sks[0].AppendTagProof(pp, &stored, r, msg, prefix))
+	assert.NoError(t, stored.Verify(pp, msg, prefix))
+
+	loaded, err := SignatureFromBytes(stored.Bytes())
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.Verify(pp, msg, prefix))
+
+	// A ring proof built by hand with a missing element is rejected rather than crashing
+	byHand := RingSignature{
+		TagCommitment: σ.TagCommitment,
+		DoryProof1:    σ.DoryProof1,
+		DoryProof2:    σ.DoryProof2,
+		B:             σ.B,
+		Z:             σ.Z,
+	}
+	assert.EqualError(t, sks[0].AppendTagProof(pp, &byHand, r, msg, prefix), "malformed signature: invalid Y: missing G1 element")
+}
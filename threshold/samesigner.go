@@ -0,0 +1,38 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"privacy-perserving-audit/tag"
+
+	math "github.com/IBM/mathlib"
+)
+
+// ProveSameSigner proves that two ring signatures, possibly over distinct rings and public parameters,
+// were made by the same key, without revealing it.
+// r1 and r2 are the randomness of the tag commitments of the signatures, as returned by PreProcessRingProof.
+func ProveSameSigner(σ1 RingSignature, r1 *math.Zr, σ2 RingSignature, r2 *math.Zr) tag.EqualityProof {
+	return ProveSameSignerWithRand(rand.Reader, σ1, r1, σ2, r2)
+}
+
+// ProveSameSignerWithRand is ProveSameSigner with randomness read from rnd.
+func ProveSameSignerWithRand(rnd io.Reader, σ1 RingSignature, r1 *math.Zr, σ2 RingSignature, r2 *math.Zr) tag.EqualityProof {
+	return tag.NewEqualityProofWithRand(rnd, σ1.TagCommitment, σ2.TagCommitment, r1, r2, σ1.Bytes(), σ2.Bytes())
+}
+
+// VerifySameSigner verifies a proof produced by ProveSameSigner.
+// The signatures are assumed to be verified against their own public parameters.
+func VerifySameSigner(σ1, σ2 RingSignature, π tag.EqualityProof) error {
+	if err := π.Verify(σ1.TagCommitment, σ2.TagCommitment, σ1.Bytes(), σ2.Bytes()); err != nil {
+		return fmt.Errorf("signatures were not made by the same signer")
+	}
+
+	return nil
+}
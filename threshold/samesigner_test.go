@@ -0,0 +1,54 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"privacy-perserving-audit/dory"
+	"testing"
+
+	math "github.com/IBM/mathlib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSameSigner(t *testing.T) {
+	pk1, sk1 := KeyGen()
+	pk2, sk2 := KeyGen()
+	pk3, _ := KeyGen()
+
+	engineering := Ring{(*math.G1)(&pk1), (*math.G1)(&pk2)}
+	security := Ring{(*math.G1)(&pk3), (*math.G1)(&pk2), (*math.G1)(&pk1)}
+
+	pps1 := dory.GeneratePublicParams(2)
+	pp1 := PublicParams{
+		DoryParams:         pps1,
+		PreProcessedParams: ComputePreProcessedParams(pps1, engineering),
+	}
+
+	pps2 := dory.GeneratePublicParams(4)
+	pp2 := PublicParams{
+		DoryParams:         pps2,
+		PreProcessedParams: ComputePreProcessedParams(pps2, security),
+	}
+
+	r1, σ1 := sk2.PreProcessRingProof(pp1, engineering)
+	assert.NoError(t, sk2.AppendTagProof(pp1, &σ1, r1, msg, prefix))
+	r2, σ2 := sk2.PreProcessRingProof(pp2, security)
+	assert.NoError(t, sk2.AppendTagProof(pp2, &σ2, r2, msg, []byte{4, 5, 6}))
+
+	assert.NoError(t, σ1.Verify(pp1, msg, prefix))
+	assert.NoError(t, σ2.Verify(pp2, msg, []byte{4, 5, 6}))
+
+	π := ProveSameSigner(σ1, r1, σ2, r2)
+	assert.NoError(t, VerifySameSigner(σ1, σ2, π))
+
+	// The proof is bound to both signatures
+	assert.EqualError(t, VerifySameSigner(σ2, σ1, π), "signatures were not made by the same signer")
+
+	r3, σ3 := sk1.PreProcessRingProof(pp2, security)
+	assert.NoError(t, sk1.AppendTagProof(pp2, &σ3, r3, msg, prefix))
+	assert.EqualError(t, VerifySameSigner(σ1, σ3, ProveSameSigner(σ1, r1, σ3, r3)), "signatures were not made by the same signer")
+}
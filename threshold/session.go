@@ -0,0 +1,473 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"crypto/rand"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	. "privacy-perserving-audit/common"
+	"privacy-perserving-audit/tag"
+
+	math "github.com/IBM/mathlib"
+)
+
+// A Session produces a threshold signature among t signers, each of which runs its own session:
+// In the first round, every signer sends the commitments of its ring proof.
+// Once all commitments are received, the challenge h is derived, and in the second round
+// every signer sends its share, which consists of its challenge vector, its response and its tag proof.
+// Once all shares are received, any session can combine them into the threshold signature.
+// The signers are identified by their index in [0, t), which they agree upon in advance.
+
+const (
+	Round1 = 1
+	Round2 = 2
+)
+
+// Message is a session message as it is sent over a transport.
+type Message struct {
+	Round   int
+	Signer  int
+	Payload []byte
+}
+
+// Round1Message carries the commitments of a signer.
+type Round1Message struct {
+	TagCommitment *math.G1
+	Y             *math.G1
+}
+
+type RawRound1Message struct {
+	TagCommitment []byte
+	Y             []byte
+}
+
+// Round2Message carries the share of a signer.
+type Round2Message struct {
+	C        []*math.Zr
+	Z        *math.Zr
+	TagValue *math.G1
+	TagProof tag.Proof
+}
+
+type RawRound2Message struct {
+	C        [][]byte
+	Z        []byte
+	TagValue []byte
+	TagProof []byte
+}
+
+func (msg Round1Message) Bytes() []byte {
+	bytes, err := asn1.Marshal(RawRound1Message{
+		TagCommitment: msg.TagCommitment.Bytes(),
+		Y:             msg.Y.Bytes(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return bytes
+}
+
+func Round1MessageFromBytes(serialized []byte) (Round1Message, error) {
+	var raw RawRound1Message
+	rest, err := asn1.Unmarshal(serialized, &raw)
+	if err != nil {
+		return Round1Message{}, fmt.Errorf("failed unmarshaling round 1 message: %v", err)
+	}
+	if len(rest) > 0 {
+		return Round1Message{}, fmt.Errorf("trailing bytes after round 1 message")
+	}
+
+	var msg Round1Message
+	if msg.TagCommitment, err = G1FromBytes(raw.TagCommitment); err != nil {
+		return Round1Message{}, fmt.Errorf("invalid tag commitment: %v", err)
+	}
+	if msg.Y, err = G1FromBytes(raw.Y); err != nil {
+		return Round1Message{}, fmt.Errorf("invalid Y: %v", err)
+	}
+
+	return msg, nil
+}
+
+func (msg Round2Message) Bytes() []byte {
+	raw := RawRound2Message{
+		Z:        msg.Z.Bytes(),
+		TagValue: msg.TagValue.Bytes(),
+		TagProof: msg.TagProof.Bytes(),
+	}
+	for _, c := range msg.C {
+		raw.C = append(raw.C, c.Bytes())
+	}
+
+	bytes, err := asn1.Marshal(raw)
+	if err != nil {
+		panic(err)
+	}
+	return bytes
+}
+
+func Round2MessageFromBytes(serialized []byte) (Round2Message, error) {
+	var raw RawRound2Message
+	rest, err := asn1.Unmarshal(serialized, &raw)
+	if err != nil {
+		return Round2Message{}, fmt.Errorf("failed unmarshaling round 2 message: %v", err)
+	}
+	if len(rest) > 0 {
+		return Round2Message{}, fmt.Errorf("trailing bytes after round 2 message")
+	}
+
+	var msg Round2Message
+	for i, c := range raw.C {
+		x, err := ZrFromBytes(c)
+		if err != nil {
+			return Round2Message{}, fmt.Errorf("invalid challenge %d: %v", i, err)
+		}
+		msg.C = append(msg.C, x)
+	}
+	if msg.Z, err = ZrFromBytes(raw.Z); err != nil {
+		return Round2Message{}, fmt.Errorf("invalid Z: %v", err)
+	}
+	if msg.TagValue, err = G1FromBytes(raw.TagValue); err != nil {
+		return Round2Message{}, fmt.Errorf("invalid tag: %v", err)
+	}
+	if msg.TagProof, err = tag.ProofFromBytes(raw.TagProof); err != nil {
+		return Round2Message{}, fmt.Errorf("invalid tag proof: %v", err)
+	}
+
+	return msg, nil
+}
+
+type Session struct {
+	tp        ThresholdParams
+	ring      Ring
+	m, prefix []byte
+	index     int
+	signer    *thresholdSigner
+
+	round1     []*Round1Message
+	round2     []*Round2Message
+	transcript *Transcript
+	h          *math.Zr
+}
+
+// NewSession starts the session of the signer at the given index.
+func (key PrivateKey) NewSession(tp ThresholdParams, ring Ring, m, prefix []byte, index int) *Session {
+	return key.NewSessionWithRand(rand.Reader, tp, ring, m, prefix, index)
+}
+
+// NewSessionWithRand is NewSession with randomness read from rnd.
+func (key PrivateKey) NewSessionWithRand(rnd io.Reader, tp ThresholdParams, ring Ring, m, prefix []byte, index int) *Session {
+	s, err := key.TryNewSessionWithRand(rnd, tp, ring, m, prefix, index)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// TryNewSessionWithRand is NewSessionWithRand, but returns an error instead of panicking if the index is out of range,
+// the key is not in the ring, the ring does not match the threshold parameters, or rnd fails.
+func (key PrivateKey) TryNewSessionWithRand(rnd io.Reader, tp ThresholdParams, ring Ring, m, prefix []byte, index int) (*Session, error) {
+	if index < 0 || index >= tp.threshold {
+		return nil, fmt.Errorf("signer index %d out of range for threshold %d", index, tp.threshold)
+	}
+
+	signer, err := key.newThresholdSigner(rnd, tp, ring)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		tp:     tp,
+		ring:   ring,
+		m:      m,
+		prefix: prefix,
+		index:  index,
+		signer: signer,
+		round1: make([]*Round1Message, tp.threshold),
+		round2: make([]*Round2Message, tp.threshold),
+	}
+
+	s.round1[index] = &Round1Message{
+		TagCommitment: s.signer.com,
+		Y:             s.signer.Y,
+	}
+	s.deriveChallenge()
+
+	return s, nil
+}
+
+// Round1 returns the first message of the signer.
+func (s *Session) Round1() Message {
+	return Message{
+		Round:   Round1,
+		Signer:  s.index,
+		Payload: s.round1[s.index].Bytes(),
+	}
+}
+
+// Round2 returns the second message of the signer, once the first messages of all signers were handled.
+func (s *Session) Round2() (Message, error) {
+	if s.h == nil {
+		return Message{}, fmt.Errorf("round 1 is not complete")
+	}
+
+	if s.round2[s.index] == nil {
+		c, z := s.signer.respond(s.h)
+		tagValue, tagProof, err := s.signer.tagProof(s.transcript, s.index, s.m, s.prefix)
+		if err != nil {
+			return Message{}, err
+		}
+		s.round2[s.index] = &Round2Message{
+			C:        c,
+			Z:        z,
+			TagValue: tagValue,
+			TagProof: tagProof,
+		}
+	}
+
+	return Message{
+		Round:   Round2,
+		Signer:  s.index,
+		Payload: s.round2[s.index].Bytes(),
+	}, nil
+}
+
+// Handle processes a message of another signer.
+// Messages of the second round may arrive before the first round is complete, and are checked once it is.
+// Messages that claim to be of this signer are rejected, as they would otherwise take the place of its own share.
+func (s *Session) Handle(msg Message) error {
+	if msg.Signer < 0 || msg.Signer >= s.tp.threshold {
+		return fmt.Errorf("signer index %d out of range for threshold %d", msg.Signer, s.tp.threshold)
+	}
+
+	if msg.Signer == s.index {
+		return fmt.Errorf("message of signer %d is of this session", msg.Signer)
+	}
+
+	switch msg.Round {
+	case Round1:
+		if s.round1[msg.Signer] != nil {
+			return fmt.Errorf("duplicate round 1 message from signer %d", msg.Signer)
+		}
+		r1, err := Round1MessageFromBytes(msg.Payload)
+		if err != nil {
+			return fmt.Errorf("signer %d: %v", msg.Signer, err)
+		}
+		s.round1[msg.Signer] = &r1
+		s.deriveChallenge()
+	case Round2:
+		if s.round2[msg.Signer] != nil {
+			return fmt.Errorf("duplicate round 2 message from signer %d", msg.Signer)
+		}
+		r2, err := Round2MessageFromBytes(msg.Payload)
+		if err != nil {
+			return fmt.Errorf("signer %d: %v", msg.Signer, err)
+		}
+		s.round2[msg.Signer] = &r2
+	default:
+		return fmt.Errorf("unknown round %d", msg.Round)
+	}
+
+	return nil
+}
+
+func (s *Session) Round1Complete() bool {
+	for _, msg := range s.round1 {
+		if msg == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Session) Round2Complete() bool {
+	for _, msg := range s.round2 {
+		if msg == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// deriveChallenge derives h once the commitments of all signers are known.
+func (s *Session) deriveChallenge() {
+	if !s.Round1Complete() {
+		return
+	}
+
+	coms, Ys := s.commitments()
+	s.transcript = thresholdTranscript(s.tp, coms, Ys)
+	s.h = s.transcript.ChallengeZr("h")
+}
+
+func (s *Session) commitments() ([]*math.G1, []*math.G1) {
+	coms := make([]*math.G1, len(s.round1))
+	Ys := make([]*math.G1, len(s.round1))
+	for k, r1 := range s.round1 {
+		coms[k], Ys[k] = r1.TagCommitment, r1.Y
+	}
+	return coms, Ys
+}
+
+// Combine checks the shares of all signers and combines them into the threshold signature.
+// The threshold signature is the signature set of the session: it carries a linkable tag for each of the signers,
+// along with a single proof that they are distinct members of the ring, see SignThreshold.
+// Signers that do not need a single proof sign on their own with Sign, and need no session.
+func (s *Session) Combine() (ThresholdSignature, error) {
+	if !s.Round2Complete() {
+		return ThresholdSignature{}, fmt.Errorf("round 2 is not complete")
+	}
+
+	if s.h == nil {
+		return ThresholdSignature{}, fmt.Errorf("round 1 is not complete")
+	}
+
+	tags := make([]*math.G1, len(s.round2))
+	for k, r2 := range s.round2 {
+		tags[k] = r2.TagValue
+	}
+	if err := checkLinked(tags); err != nil {
+		return ThresholdSignature{}, err
+	}
+
+	for k := range s.round2 {
+		if err := s.checkShare(k); err != nil {
+			return ThresholdSignature{}, fmt.Errorf("share of signer %d is invalid: %v", k, err)
+		}
+	}
+
+	coms, Ys := s.commitments()
+	c := make([][]*math.Zr, len(s.round2))
+	zs := make([]*math.Zr, len(s.round2))
+	for k, r2 := range s.round2 {
+		c[k], zs[k] = r2.C, r2.Z
+	}
+
+	// Proving appends to the transcript, hence it is done on a fresh one so that the session can combine again
+	t := thresholdTranscript(s.tp, coms, Ys)
+	h := t.ChallengeZr("h")
+	ts := proveThreshold(s.tp, s.ring, t, h, coms, Ys, c, zs)
+	for k, r2 := range s.round2 {
+		ts.Signers[k].TagValue, ts.Signers[k].TagProof = r2.TagValue, r2.TagProof
+	}
+
+	return ts, nil
+}
+
+// checkShare checks that the challenges of the k'th signer sum up to h, that they satisfy its ring equation
+// z H - Y = Σ c_i (com - pk_i), and that its tag proof is valid.
+func (s *Session) checkShare(k int) error {
+	r1, r2 := s.round1[k], s.round2[k]
+	ring := s.ring.Pad(s.tp.blockSize())
+
+	if len(r2.C) != len(ring) {
+		return fmt.Errorf("expected %d challenges but got %d", len(ring), len(r2.C))
+	}
+
+	if !sumZr(r2.C...).Equals(s.h) {
+		return fmt.Errorf("challenges do not sum up to h")
+	}
+
+	expected := H().Mul(r2.Z)
+	expected.Sub(r1.Y)
+
+	actual := curve.NewG1()
+	for i, pk := range ring {
+		x := r1.TagCommitment.Copy()
+		x.Sub(pk)
+		actual.Add(x.Mul(r2.C[i]))
+	}
+
+	if !expected.Equals(actual) {
+		return fmt.Errorf("ring equation does not hold")
+	}
+
+	return r2.TagProof.VerifyWithTranscript(signerTranscript(s.transcript, k, s.m), r2.TagValue, r1.TagCommitment, s.prefix)
+}
+
+// Transport delivers the messages of a session to the sessions of all other signers.
+type Transport interface {
+	Broadcast(msg Message) error
+	Receive() (Message, error)
+}
+
+// Run runs the session over the given transport until the threshold signature is combined.
+func (s *Session) Run(transport Transport) (ThresholdSignature, error) {
+	if err := transport.Broadcast(s.Round1()); err != nil {
+		return ThresholdSignature{}, err
+	}
+
+	for !s.Round1Complete() {
+		if err := s.receive(transport); err != nil {
+			return ThresholdSignature{}, err
+		}
+	}
+
+	msg, err := s.Round2()
+	if err != nil {
+		return ThresholdSignature{}, err
+	}
+
+	if err := transport.Broadcast(msg); err != nil {
+		return ThresholdSignature{}, err
+	}
+
+	for !s.Round2Complete() {
+		if err := s.receive(transport); err != nil {
+			return ThresholdSignature{}, err
+		}
+	}
+
+	return s.Combine()
+}
+
+func (s *Session) receive(transport Transport) error {
+	msg, err := transport.Receive()
+	if err != nil {
+		return err
+	}
+	return s.Handle(msg)
+}
+
+// MemoryTransport is a Transport among sessions of the same process.
+type MemoryTransport struct {
+	index   int
+	inboxes []chan Message
+}
+
+// NewMemoryTransports returns connected transports for n signers, the i'th of which belongs to the i'th signer.
+func NewMemoryTransports(n int) []*MemoryTransport {
+	inboxes := make([]chan Message, n)
+	for i := range inboxes {
+		// Every signer sends at most one message per round to every other signer
+		inboxes[i] = make(chan Message, 2*n)
+	}
+
+	transports := make([]*MemoryTransport, n)
+	for i := range transports {
+		transports[i] = &MemoryTransport{
+			index:   i,
+			inboxes: inboxes,
+		}
+	}
+
+	return transports
+}
+
+func (mt *MemoryTransport) Broadcast(msg Message) error {
+	for i, inbox := range mt.inboxes {
+		if i != mt.index {
+			inbox <- msg
+		}
+	}
+	return nil
+}
+
+func (mt *MemoryTransport) Receive() (Message, error) {
+	return <-mt.inboxes[mt.index], nil
+}
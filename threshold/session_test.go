@@ -0,0 +1,117 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"privacy-perserving-audit/dory"
+	"testing"
+
+	math "github.com/IBM/mathlib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	var ring Ring
+	var sks []PrivateKey
+	for i := 0; i < 5; i++ {
+		pk, sk := KeyGen()
+		ring = append(ring, (*math.G1)(&pk))
+		sks = append(sks, sk)
+	}
+
+	pps := dory.GeneratePublicParams(ThresholdDorySize(len(ring), 3))
+	tp := ComputeThresholdParams(pps, ring, 3)
+
+	signers := []PrivateKey{sks[3], sks[1], sks[4]}
+	transports := NewMemoryTransports(len(signers))
+
+	type result struct {
+		ts  ThresholdSignature
+		err error
+	}
+
+	results := make(chan result, len(signers))
+	for i, sk := range signers {
+		go func(s *Session, transport Transport) {
+			ts, err := s.Run(transport)
+			results <- result{ts: ts, err: err}
+		}(sk.NewSession(tp, ring, msg, prefix, i), transports[i])
+	}
+
+	for range signers {
+		res := <-results
+		assert.NoError(t, res.err)
+		assert.NoError(t, res.ts.Verify(tp, msg, prefix))
+	}
+
+	_, err := sks[0].TryNewSessionWithRand(rand.Reader, tp, ring, msg, prefix, 3)
+	assert.EqualError(t, err, "signer index 3 out of range for threshold 3")
+	_, outsider := KeyGen()
+	_, err = outsider.TryNewSessionWithRand(rand.Reader, tp, ring, msg, prefix, 0)
+	assert.True(t, errors.Is(err, ErrNotInRing))
+	_, err = sks[0].TryNewSessionWithRand(rand.Reader, tp, ring[:4], msg, prefix, 0)
+	assert.True(t, errors.Is(err, ErrRingSizeMismatch))
+	for _, n := range []int64{10, 100, 300} {
+		_, err = sks[0].TryNewSessionWithRand(io.LimitReader(rand.Reader, n), tp, ring, msg, prefix, 0)
+		assert.EqualError(t, err, "failed reading randomness: unexpected EOF")
+	}
+
+	// Messages are handled once and only from known signers
+	s0 := sks[0].NewSession(tp, ring, msg, prefix, 0)
+	s1 := sks[2].NewSession(tp, ring, msg, prefix, 1)
+	s2 := sks[4].NewSession(tp, ring, msg, prefix, 2)
+
+	_, err = s0.Round2()
+	assert.EqualError(t, err, "round 1 is not complete")
+
+	assert.NoError(t, s0.Handle(s1.Round1()))
+	assert.EqualError(t, s0.Handle(s1.Round1()), "duplicate round 1 message from signer 1")
+	assert.EqualError(t, s0.Handle(Message{Round: Round1, Signer: 3}), "signer index 3 out of range for threshold 3")
+	assert.EqualError(t, s0.Handle(Message{Round: 3, Signer: 2}), "unknown round 3")
+	assert.EqualError(t, s0.Handle(s0.Round1()), "message of signer 0 is of this session")
+	assert.EqualError(t, s0.Handle(Message{Round: Round2, Signer: 0}), "message of signer 0 is of this session")
+
+	for _, s := range []*Session{s0, s1, s2} {
+		for _, other := range []*Session{s0, s1, s2} {
+			if s != other && s.round1[other.index] == nil {
+				assert.NoError(t, s.Handle(other.Round1()))
+			}
+		}
+	}
+
+	_, err = s0.Combine()
+	assert.EqualError(t, err, "round 2 is not complete")
+
+	m0, err := s0.Round2()
+	assert.NoError(t, err)
+	m2, err := s2.Round2()
+	assert.NoError(t, err)
+
+	// A share that does not satisfy the ring equation is detected
+	m1, err := s1.Round2()
+	assert.NoError(t, err)
+	share, err := Round2MessageFromBytes(m1.Payload)
+	assert.NoError(t, err)
+	share.Z = share.Z.Plus(curve.NewZrFromInt(1))
+	m1.Payload = share.Bytes()
+
+	assert.NoError(t, s0.Handle(m1))
+	assert.NoError(t, s0.Handle(m2))
+	_, err = s0.Combine()
+	assert.EqualError(t, err, "share of signer 1 is invalid: ring equation does not hold")
+
+	assert.NoError(t, s2.Handle(m0))
+	m1, err = s1.Round2()
+	assert.NoError(t, err)
+	assert.NoError(t, s2.Handle(m1))
+	ts, err := s2.Combine()
+	assert.NoError(t, err)
+	assert.NoError(t, ts.Verify(tp, msg, prefix))
+}
@@ -0,0 +1,656 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	. "privacy-perserving-audit/common"
+	. "privacy-perserving-audit/dory"
+	"privacy-perserving-audit/tag"
+
+	math "github.com/IBM/mathlib"
+)
+
+// A t-of-n threshold signature consists of t ring proofs, one per signer, each with its own tag commitment.
+// Instead of proving each of them with its own pair of Dory proofs, the vectors of all ring proofs are concatenated
+// into a single vector of t blocks, hence the challenge vector c has t secret positions, one in every block.
+// The blocks are weighted by the powers of a challenge ρ, so that a single pair of Dory proofs shows that every
+// block satisfies its ring equation and sums up to h. The t tags are distinct, hence the t signers are distinct.
+// The tag proofs are derived from the transcript right after h, so that every signer can produce its tag proof
+// along with its response, before the Dory proofs are made.
+
+// ThresholdParams are the public parameters of t-of-n threshold signatures over a ring.
+type ThresholdParams struct {
+	DoryParams []PP
+	digest     []byte
+	threshold  int
+	ringSize   int
+	// Γ2 holds the sum of every block of the Dory public parameters Γ2
+	Γ2 G2v
+	// A0Inverse holds the inverse of the inner product of the padded ring and every block of Γ2
+	A0Inverse []*math.Gt
+}
+
+// ThresholdDorySize returns the size of the Dory public parameters needed for t-of-n threshold signatures
+// over a ring of size n.
+func ThresholdDorySize(n, t int) int {
+	return PaddedSize(t) * PaddedSize(n)
+}
+
+// ComputeThresholdParams computes the public parameters of threshold signatures of t out of the given ring.
+// The Dory public parameters should be generated for ThresholdDorySize(len(ring), t).
+func ComputeThresholdParams(doryParams []PP, ring Ring, t int) ThresholdParams {
+	tp, err := TryComputeThresholdParams(doryParams, ring, t)
+	if err != nil {
+		panic(err)
+	}
+	return tp
+}
+
+// TryComputeThresholdParams is ComputeThresholdParams, but returns an error instead of panicking if the threshold is invalid,
+// a ring member is missing, or the Dory public parameters are malformed or too small.
+func TryComputeThresholdParams(doryParams []PP, ring Ring, t int) (ThresholdParams, error) {
+	if t < 1 || t > len(ring) {
+		return ThresholdParams{}, fmt.Errorf("threshold %d is invalid for a ring of size %d", t, len(ring))
+	}
+
+	for i, pk := range ring {
+		if pk == nil {
+			return ThresholdParams{}, fmt.Errorf("ring member %d is missing", i)
+		}
+	}
+
+	if err := CheckPublicParams(doryParams); err != nil {
+		return ThresholdParams{}, err
+	}
+
+	n := PaddedSize(len(ring))
+	Γ2 := doryParams[0].Γ2
+	if len(Γ2) < t*n {
+		return ThresholdParams{}, fmt.Errorf("%w: Dory public parameters of size %d are too small for %d blocks of size %d", ErrParamsMismatch, len(Γ2), t, n)
+	}
+
+	tp := ThresholdParams{
+		DoryParams: doryParams,
+		threshold:  t,
+		ringSize:   len(ring),
+		Γ2:         make(G2v, t),
+		A0Inverse:  make([]*math.Gt, t),
+	}
+
+	padded := ring.Pad(n)
+
+	tasks := make([]func(), t)
+	for k := range tasks {
+		k := k
+		tasks[k] = func() {
+			block := Γ2[k*n : (k+1)*n]
+			tp.Γ2[k] = block.Sum()
+			tp.A0Inverse[k] = executorOf(doryParams).InnerProd(G1v(padded), block)
+			tp.A0Inverse[k].Inverse()
+		}
+	}
+
+	executorOf(doryParams).Parallel(tasks...)
+
+	tp.digest = tp.computeDigest()
+	return tp, nil
+}
+
+// With returns a copy of the threshold parameters configured with the given options.
+func (tp ThresholdParams) With(opts ...Option) ThresholdParams {
+	for _, opt := range opts {
+		tp.DoryParams = opt(tp.DoryParams)
+	}
+	return tp
+}
+
+// Threshold returns the number of signers required.
+func (tp ThresholdParams) Threshold() int {
+	return tp.threshold
+}
+
+// RingSize returns the number of members in the ring, without the padding.
+func (tp ThresholdParams) RingSize() int {
+	return tp.ringSize
+}
+
+func (tp ThresholdParams) blockSize() int {
+	return PaddedSize(tp.ringSize)
+}
+
+// check checks that the threshold parameters are consistent with each other, so that signatures can be made
+// and verified with them.
+func (tp ThresholdParams) check() error {
+	if err := CheckPublicParams(tp.DoryParams); err != nil {
+		return err
+	}
+
+	if tp.threshold < 1 || tp.threshold > tp.ringSize {
+		return fmt.Errorf("%w: threshold %d is invalid for a ring of size %d", ErrParamsMismatch, tp.threshold, tp.ringSize)
+	}
+
+	if len(tp.Γ2) != tp.threshold || len(tp.A0Inverse) != tp.threshold {
+		return fmt.Errorf("%w: missing pre-processed parameters", ErrParamsMismatch)
+	}
+
+	for k := range tp.Γ2 {
+		if tp.Γ2[k] == nil || tp.A0Inverse[k] == nil {
+			return fmt.Errorf("%w: missing pre-processed parameters", ErrParamsMismatch)
+		}
+	}
+
+	if n := tp.threshold * tp.blockSize(); len(tp.DoryParams[0].Γ1) < n {
+		return fmt.Errorf("%w: Dory public parameters of size %d are too small for %d blocks of size %d", ErrParamsMismatch, len(tp.DoryParams[0].Γ1), tp.threshold, tp.blockSize())
+	}
+
+	return nil
+}
+
+func (tp ThresholdParams) computeDigest() []byte {
+	sizes := make([]byte, 16)
+	binary.BigEndian.PutUint64(sizes, uint64(tp.threshold))
+	binary.BigEndian.PutUint64(sizes[8:], uint64(tp.ringSize))
+
+	h := sha256.New()
+	h.Write(sizes)
+	h.Write(tp.Γ2.Bytes())
+	for _, a := range tp.A0Inverse {
+		h.Write(a.Bytes())
+	}
+	h.Write(tp.DoryParams[len(tp.DoryParams)-1].Digest(nil))
+	return h.Sum(nil)
+}
+
+// SignerProof is the part of a threshold signature that belongs to a single signer.
+type SignerProof struct {
+	TagProof      tag.Proof
+	TagCommitment *math.G1
+	TagValue      *math.G1
+	Y             *math.G1
+	Z             *math.Zr
+}
+
+type ThresholdSignature struct {
+	Signers    []SignerProof
+	B          *math.Gt
+	DoryProof1 Proof
+	DoryProof2 Proof
+}
+
+// Tags returns the tags of the signers, which link them to their other signatures under the same prefix.
+func (ts ThresholdSignature) Tags() []*math.G1 {
+	tags := make([]*math.G1, len(ts.Signers))
+	for k, s := range ts.Signers {
+		tags[k] = s.TagValue
+	}
+	return tags
+}
+
+// thresholdSigner holds the state of a single signer of a threshold signature.
+type thresholdSigner struct {
+	rnd     io.Reader
+	key     PrivateKey
+	pkIndex int
+	w       *tag.Witness
+	com     *math.G1
+	y       *math.Zr
+	c       []*math.Zr
+	Y       *math.G1
+}
+
+// newThresholdSigner commits to the tag of the signer, and chooses the challenges of all other ring members.
+func (key PrivateKey) newThresholdSigner(rnd io.Reader, tp ThresholdParams, ring Ring) (*thresholdSigner, error) {
+	if len(ring) != tp.ringSize {
+		return nil, fmt.Errorf("%w: ring of size %d does not match public parameters of a ring of size %d", ErrRingSizeMismatch, len(ring), tp.ringSize)
+	}
+
+	for i, pk := range ring {
+		if pk == nil {
+			return nil, fmt.Errorf("ring member %d is missing", i)
+		}
+	}
+
+	sk := math.Zr(key)
+	_, pkIndex, err := key.findPK(ring)
+	if err != nil {
+		return nil, err
+	}
+
+	w, com, err := tag.TryCommitWithRand(rnd, &sk)
+	if err != nil {
+		return nil, err
+	}
+
+	ring = ring.Pad(tp.blockSize())
+
+	s := &thresholdSigner{
+		rnd:     rnd,
+		key:     key,
+		pkIndex: pkIndex,
+		w:       w,
+		com:     com,
+		c:       make([]*math.Zr, len(ring)-1),
+	}
+
+	if s.y, err = RandomZr(rnd); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(s.c); i++ {
+		if s.c[i], err = RandomZr(rnd); err != nil {
+			return nil, err
+		}
+	}
+
+	s.Y = computeY(s.y, s.c, com, ring, pkIndex)
+
+	return s, nil
+}
+
+// respond computes the challenge of the signer's position in the ring so that all challenges sum up to h,
+// and returns all challenges along with the response z.
+func (s *thresholdSigner) respond(h *math.Zr) ([]*math.Zr, *math.Zr) {
+	cj := h.Plus(negZr(sumZr(s.c...)))
+	cj.Mod(curve.GroupOrder)
+
+	z := s.y.Plus(cj.Mul(&s.w.R))
+	z.Mod(curve.GroupOrder)
+
+	return embedInVec(s.c, cj, s.pkIndex), z
+}
+
+func (s *thresholdSigner) tagProof(t *Transcript, k int, m, prefix []byte) (*math.G1, tag.Proof, error) {
+	sk := math.Zr(s.key)
+	π, err := tag.TryNewProofWithRand(s.rnd, signerTranscript(t, k, m), prefix, &sk, s.w)
+	if err != nil {
+		return nil, tag.Proof{}, err
+	}
+	return tag.Tag(&sk, prefix), π, nil
+}
+
+// SignThreshold produces a threshold signature on behalf of the given keys, which should be exactly as many as the threshold.
+func SignThreshold(tp ThresholdParams, m []byte, prefix []byte, ring Ring, keys ...PrivateKey) ThresholdSignature {
+	return SignThresholdWithRand(rand.Reader, tp, m, prefix, ring, keys...)
+}
+
+// TrySignThreshold is SignThreshold, but returns an error instead of panicking if the number of keys is not the threshold,
+// a key is not in the ring, or the ring or the threshold parameters are malformed.
+func TrySignThreshold(tp ThresholdParams, m []byte, prefix []byte, ring Ring, keys ...PrivateKey) (ThresholdSignature, error) {
+	return TrySignThresholdWithRand(rand.Reader, tp, m, prefix, ring, keys...)
+}
+
+// SignThresholdWithRand is SignThreshold with randomness read from rnd.
+func SignThresholdWithRand(rnd io.Reader, tp ThresholdParams, m []byte, prefix []byte, ring Ring, keys ...PrivateKey) ThresholdSignature {
+	ts, err := TrySignThresholdWithRand(rnd, tp, m, prefix, ring, keys...)
+	if err != nil {
+		panic(err)
+	}
+	return ts
+}
+
+// TrySignThresholdWithRand is SignThresholdWithRand, but returns an error instead of panicking,
+// in particular if rnd fails to provide randomness.
+func TrySignThresholdWithRand(rnd io.Reader, tp ThresholdParams, m []byte, prefix []byte, ring Ring, keys ...PrivateKey) (ThresholdSignature, error) {
+	if len(keys) != tp.threshold {
+		return ThresholdSignature{}, fmt.Errorf("%d keys given but threshold is %d", len(keys), tp.threshold)
+	}
+
+	if err := tp.check(); err != nil {
+		return ThresholdSignature{}, err
+	}
+
+	signers := make([]*thresholdSigner, len(keys))
+	coms := make([]*math.G1, len(keys))
+	Ys := make([]*math.G1, len(keys))
+	for k, key := range keys {
+		s, err := key.newThresholdSigner(rnd, tp, ring)
+		if err != nil {
+			return ThresholdSignature{}, fmt.Errorf("key %d: %w", k, err)
+		}
+		signers[k] = s
+		coms[k], Ys[k] = s.com, s.Y
+	}
+
+	t := thresholdTranscript(tp, coms, Ys)
+	h := t.ChallengeZr("h")
+
+	c := make([][]*math.Zr, len(keys))
+	zs := make([]*math.Zr, len(keys))
+	tags := make([]*math.G1, len(keys))
+	tagProofs := make([]tag.Proof, len(keys))
+	for k, s := range signers {
+		c[k], zs[k] = s.respond(h)
+		var err error
+		if tags[k], tagProofs[k], err = s.tagProof(t, k, m, prefix); err != nil {
+			return ThresholdSignature{}, err
+		}
+	}
+
+	ts := proveThreshold(tp, ring, t, h, coms, Ys, c, zs)
+
+	for k := range signers {
+		ts.Signers[k].TagValue, ts.Signers[k].TagProof = tags[k], tagProofs[k]
+	}
+
+	return ts, nil
+}
+
+// proveThreshold proves the ring equations of all signers given their commitments, challenges and responses.
+func proveThreshold(tp ThresholdParams, ring Ring, t *Transcript, h *math.Zr, coms, Ys []*math.G1, c [][]*math.Zr, zs []*math.Zr) ThresholdSignature {
+	n := tp.blockSize()
+	ring = ring.Pad(n)
+	dpp := tp.DoryParams[0]
+
+	var V1, H1 G1v
+	var V2 G2v
+	for k := range coms {
+		V2 = append(V2, G2v{curve.GenG2}.Duplicate(n).Mulv(c[k])...)
+	}
+
+	B := dpp.Executor().InnerProd(dpp.Γ1[:len(V2)], V2)
+
+	ρ := appendResponses(t, zs, B)
+	weights := powers(ρ, len(coms))
+
+	for k := range coms {
+		V1 = append(V1, ring.Neg().Add(G1v{coms[k]}.Duplicate(n)).Mul(weights[k])...)
+		H1 = append(H1, G1v{H().Mul(weights[k])}.Duplicate(n)...)
+	}
+
+	cmt1, cmt2 := thresholdStatements(tp, h, weights, coms, Ys, zs, B)
+
+	var π1, π2 Proof
+
+	ringProofTranscript, sumProofTranscript := t.Fork("ring"), t.Fork("sum")
+
+	executorOf(tp.DoryParams).Parallel(func() {
+		π1 = ReduceWithTranscript(ringProofTranscript, tp.DoryParams, Witness{V1: V1, V2: V2}, cmt1)
+	}, func() {
+		π2 = ReduceWithTranscript(sumProofTranscript, tp.DoryParams, Witness{V1: H1, V2: V2}, cmt2)
+	})
+
+	ts := ThresholdSignature{
+		Signers:    make([]SignerProof, len(coms)),
+		B:          B,
+		DoryProof1: π1,
+		DoryProof2: π2,
+	}
+
+	for k := range coms {
+		ts.Signers[k] = SignerProof{
+			TagCommitment: coms[k],
+			Y:             Ys[k],
+			Z:             zs[k],
+		}
+	}
+
+	return ts
+}
+
+// thresholdStatements returns the commitments of the ring proof and of the sum proof:
+// The ring proof shows that Σ ρ^k (z_k H - Y_k) = Σ ρ^k <com_k - ring, c_k>,
+// and the sum proof shows that Σ ρ^k h = Σ ρ^k <1, c_k>, where c_k is the k'th block of the challenge vector.
+func thresholdStatements(tp ThresholdParams, h *math.Zr, weights []*math.Zr, coms, Ys []*math.G1, zs []*math.Zr, B *math.Gt) (Commitment, Commitment) {
+	zHByY := curve.NewG1()
+	weightedComs := make(G1v, len(coms))
+	weightedΓ2 := curve.NewG2()
+	weightSum := curve.NewZrFromInt(0)
+
+	for k := range coms {
+		x := H().Mul(zs[k])
+		x.Sub(Ys[k])
+		zHByY.Add(x.Mul(weights[k]))
+
+		weightedComs[k] = coms[k].Mul(weights[k])
+		weightedΓ2.Add(tp.Γ2[k].Mul(weights[k]))
+		weightSum = weightSum.Plus(weights[k])
+	}
+
+	A := executorOf(tp.DoryParams).InnerProd(weightedComs, tp.Γ2[:len(coms)])
+	A.Mul(MultiExpGt(tp.A0Inverse[:len(coms)], weights))
+
+	weightSum.Mod(curve.GroupOrder)
+
+	return Commitment{
+		C:  e(zHByY, curve.GenG2),
+		D1: A,
+		D2: B,
+	}, Commitment{
+		C:  e(H().Mul(h.Mul(weightSum)), curve.GenG2),
+		D1: e(H(), weightedΓ2),
+		D2: B,
+	}
+}
+
+// Verify verifies the threshold signature, including that its signers are distinct.
+func (ts ThresholdSignature) Verify(tp ThresholdParams, m, prefix []byte) error {
+	if err := ts.check(tp); err != nil {
+		return err
+	}
+
+	if err := checkLinked(ts.Tags()); err != nil {
+		return err
+	}
+
+	coms := make([]*math.G1, len(ts.Signers))
+	Ys := make([]*math.G1, len(ts.Signers))
+	zs := make([]*math.Zr, len(ts.Signers))
+	for k, s := range ts.Signers {
+		coms[k], Ys[k], zs[k] = s.TagCommitment, s.Y, s.Z
+	}
+
+	t := thresholdTranscript(tp, coms, Ys)
+	h := t.ChallengeZr("h")
+
+	tagChecks := make([]tag.Check, len(ts.Signers))
+	for k, s := range ts.Signers {
+		tagChecks[k] = s.TagProof.PrepareVerification(signerTranscript(t, k, m), s.TagValue, s.TagCommitment, prefix)
+	}
+
+	ρ := appendResponses(t, zs, ts.B)
+
+	cmt1, cmt2 := thresholdStatements(tp, h, powers(ρ, len(coms)), coms, Ys, zs, ts.B)
+
+	ringProofTranscript, sumProofTranscript := t.Fork("ring"), t.Fork("sum")
+
+	var ringProof, sumProof FinalCheck
+
+	executorOf(tp.DoryParams).Parallel(func() {
+		ringProof = PrepareVerification(ringProofTranscript, tp.DoryParams, cmt1, ts.DoryProof1)
+	}, func() {
+		sumProof = PrepareVerification(sumProofTranscript, tp.DoryParams, cmt2, ts.DoryProof2)
+	})
+
+	if err := BatchVerify([]FinalCheck{ringProof, sumProof}); err != nil {
+		return fmt.Errorf("Dory proofs invalid")
+	}
+
+	if err := tag.BatchVerify(tagChecks); err != nil {
+		return fmt.Errorf("tag proofs invalid")
+	}
+
+	return nil
+}
+
+// check checks that the threshold signature has a proof for every signer, and that all of its elements are present,
+// so that verification does not panic. As for ring signatures, the subgroup checks are made when parsing.
+func (ts ThresholdSignature) check(tp ThresholdParams) error {
+	if err := tp.check(); err != nil {
+		return err
+	}
+
+	if len(ts.Signers) != tp.threshold {
+		return fmt.Errorf("signature has %d signers but threshold is %d", len(ts.Signers), tp.threshold)
+	}
+
+	for k, s := range ts.Signers {
+		if err := checkNotIdentity(s.TagCommitment); err != nil {
+			return fmt.Errorf("malformed signature: signer %d: invalid tag commitment: %v", k, err)
+		}
+		if err := checkNotIdentity(s.Y); err != nil {
+			return fmt.Errorf("malformed signature: signer %d: invalid Y: %v", k, err)
+		}
+		if s.Z == nil {
+			return fmt.Errorf("malformed signature: signer %d: invalid Z: missing scalar", k)
+		}
+		if err := checkNotIdentity(s.TagValue); err != nil {
+			return fmt.Errorf("malformed signature: signer %d: invalid tag: %v", k, err)
+		}
+		if err := s.TagProof.CheckShape(); err != nil {
+			return fmt.Errorf("malformed signature: signer %d: invalid tag proof: %v", k, err)
+		}
+	}
+
+	if ts.B == nil {
+		return fmt.Errorf("malformed signature: invalid B: missing Gt element")
+	}
+	if ts.B.IsUnity() {
+		return fmt.Errorf("malformed signature: invalid B: identity element")
+	}
+
+	if err := ts.DoryProof1.CheckShape(tp.DoryParams); err != nil {
+		return fmt.Errorf("malformed signature: invalid first Dory proof: %w", err)
+	}
+	if err := ts.DoryProof2.CheckShape(tp.DoryParams); err != nil {
+		return fmt.Errorf("malformed signature: invalid second Dory proof: %w", err)
+	}
+
+	return nil
+}
+
+// thresholdTranscript starts the transcript of a threshold signature, from which the ring challenge h is derived.
+func thresholdTranscript(tp ThresholdParams, coms, Ys []*math.G1) *Transcript {
+	t := NewTranscript(ThresholdSignatureLabel)
+	t.AppendBytes("pp", tp.digest)
+	for k := range coms {
+		t.AppendG1("commitment", coms[k])
+		t.AppendG1("Y", Ys[k])
+	}
+	return t
+}
+
+// appendResponses appends the responses of the signers and the commitment to the challenge vector
+// to the transcript, and derives the challenge ρ that weights the blocks of the challenge vector.
+func appendResponses(t *Transcript, zs []*math.Zr, B *math.Gt) *math.Zr {
+	for _, z := range zs {
+		t.AppendZr("z", z)
+	}
+	t.AppendGt("B", B)
+	return t.ChallengeZr("ρ")
+}
+
+// signerTranscript is the transcript of the tag proof of the k'th signer.
+func signerTranscript(t *Transcript, k int, m []byte) *Transcript {
+	index := make([]byte, 8)
+	binary.BigEndian.PutUint64(index, uint64(k))
+
+	signerTranscript := tagTranscript(t, m)
+	signerTranscript.AppendBytes("signer", index)
+	return signerTranscript
+}
+
+func powers(x *math.Zr, n int) []*math.Zr {
+	res := make([]*math.Zr, n)
+	res[0] = curve.NewZrFromInt(1)
+	for i := 1; i < n; i++ {
+		res[i] = res[i-1].Mul(x)
+		res[i].Mod(curve.GroupOrder)
+	}
+	return res
+}
+
+func (ts ThresholdSignature) Bytes() []byte {
+	rts := RawThresholdSignature{
+		B:          ts.B.Bytes(),
+		DoryProof1: ts.DoryProof1.Bytes(),
+		DoryProof2: ts.DoryProof2.Bytes(),
+	}
+
+	for _, s := range ts.Signers {
+		rts.Signers = append(rts.Signers, RawSignerProof{
+			TagProof:      s.TagProof.Bytes(),
+			TagCommitment: s.TagCommitment.Bytes(),
+			TagValue:      s.TagValue.Bytes(),
+			Y:             s.Y.Bytes(),
+			Z:             s.Z.Bytes(),
+		})
+	}
+
+	bytes, err := asn1.Marshal(rts)
+	if err != nil {
+		panic(err)
+	}
+
+	return bytes
+}
+
+type RawThresholdSignature struct {
+	Signers    []RawSignerProof
+	B          []byte
+	DoryProof1 []byte
+	DoryProof2 []byte
+}
+
+type RawSignerProof struct {
+	TagProof      []byte
+	TagCommitment []byte
+	TagValue      []byte
+	Y             []byte
+	Z             []byte
+}
+
+// ThresholdSignatureFromBytes parses a threshold signature, ensuring all group elements are valid.
+func ThresholdSignatureFromBytes(serialized []byte) (ThresholdSignature, error) {
+	var rts RawThresholdSignature
+	rest, err := asn1.Unmarshal(serialized, &rts)
+	if err != nil {
+		return ThresholdSignature{}, fmt.Errorf("failed unmarshaling threshold signature: %v", err)
+	}
+	if len(rest) > 0 {
+		return ThresholdSignature{}, fmt.Errorf("trailing bytes after threshold signature")
+	}
+
+	var ts ThresholdSignature
+
+	for k, rs := range rts.Signers {
+		var s SignerProof
+		if s.TagProof, err = tag.ProofFromBytes(rs.TagProof); err != nil {
+			return ThresholdSignature{}, fmt.Errorf("signer %d: invalid tag proof: %v", k, err)
+		}
+		if s.TagCommitment, err = G1FromBytes(rs.TagCommitment); err != nil {
+			return ThresholdSignature{}, fmt.Errorf("signer %d: invalid tag commitment: %v", k, err)
+		}
+		if s.TagValue, err = G1FromBytes(rs.TagValue); err != nil {
+			return ThresholdSignature{}, fmt.Errorf("signer %d: invalid tag: %v", k, err)
+		}
+		if s.Y, err = G1FromBytes(rs.Y); err != nil {
+			return ThresholdSignature{}, fmt.Errorf("signer %d: invalid Y: %v", k, err)
+		}
+		if s.Z, err = ZrFromBytes(rs.Z); err != nil {
+			return ThresholdSignature{}, fmt.Errorf("signer %d: invalid Z: %v", k, err)
+		}
+		ts.Signers = append(ts.Signers, s)
+	}
+
+	if ts.B, err = GtFromBytes(rts.B); err != nil {
+		return ThresholdSignature{}, fmt.Errorf("invalid B: %v", err)
+	}
+	if ts.DoryProof1, err = ProofFromBytes(rts.DoryProof1); err != nil {
+		return ThresholdSignature{}, fmt.Errorf("invalid first Dory proof: %v", err)
+	}
+	if ts.DoryProof2, err = ProofFromBytes(rts.DoryProof2); err != nil {
+		return ThresholdSignature{}, fmt.Errorf("invalid second Dory proof: %v", err)
+	}
+
+	return ts, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"errors"
+	"privacy-perserving-audit/dory"
+	"testing"
+
+	math "github.com/IBM/mathlib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThresholdSignature(t *testing.T) {
+	var ring Ring
+	var sks []PrivateKey
+	for i := 0; i < 5; i++ {
+		pk, sk := KeyGen()
+		ring = append(ring, (*math.G1)(&pk))
+		sks = append(sks, sk)
+	}
+
+	assert.Equal(t, 32, ThresholdDorySize(5, 3))
+
+	pps := dory.GeneratePublicParams(ThresholdDorySize(len(ring), 3))
+	tp := ComputeThresholdParams(pps, ring, 3)
+	assert.Equal(t, 3, tp.Threshold())
+	assert.Equal(t, 5, tp.RingSize())
+
+	ts := SignThreshold(tp, msg, prefix, ring, sks[4], sks[0], sks[2])
+	assert.NoError(t, ts.Verify(tp, msg, prefix))
+	assert.EqualError(t, ts.Verify(tp, []byte("another message"), prefix), "tag proofs invalid")
+
+	// The tags link the signers to their ring signatures under the same prefix
+	ringPPs := dory.GeneratePublicParams(len(ring))
+	pp := PublicParams{
+		DoryParams:         ringPPs,
+		PreProcessedParams: ComputePreProcessedParams(ringPPs, ring),
+	}
+	σ := sks[0].Sign(pp, msg, prefix, ring)
+	assert.True(t, σ.TagValue.Equals(ts.Tags()[1]))
+
+	loaded, err := ThresholdSignatureFromBytes(ts.Bytes())
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.Verify(tp, msg, prefix))
+
+	// A signer that signs twice does not count twice
+	twice := SignThreshold(tp, msg, prefix, ring, sks[4], sks[0], sks[0])
+	err = twice.Verify(tp, msg, prefix)
+	var linkedErr *LinkedSignaturesError
+	assert.True(t, errors.As(err, &linkedErr))
+	assert.Equal(t, [][]int{{1, 2}}, linkedErr.Linked)
+
+	// Signers cannot be dropped, nor swapped with signers of another signature
+	tampered := SignThreshold(tp, msg, prefix, ring, sks[4], sks[0], sks[2])
+	tampered.Signers = tampered.Signers[:2]
+	assert.EqualError(t, tampered.Verify(tp, msg, prefix), "signature has 2 signers but threshold is 3")
+
+	other := SignThreshold(tp, msg, prefix, ring, sks[1], sks[3], sks[2])
+	tampered = SignThreshold(tp, msg, prefix, ring, sks[4], sks[0], sks[2])
+	tampered.Signers[1] = other.Signers[1]
+	assert.EqualError(t, tampered.Verify(tp, msg, prefix), "Dory proofs invalid")
+
+	assert.Panics(t, func() {
+		SignThreshold(tp, msg, prefix, ring, sks[4], sks[0])
+	})
+
+	_, err = TrySignThreshold(tp, msg, prefix, ring, sks[4], sks[0])
+	assert.EqualError(t, err, "2 keys given but threshold is 3")
+	_, outsider := KeyGen()
+	_, err = TrySignThreshold(tp, msg, prefix, ring, sks[4], outsider, sks[2])
+	assert.True(t, errors.Is(err, ErrNotInRing))
+	_, err = TrySignThreshold(ThresholdParams{threshold: 3}, msg, prefix, ring, sks[4], sks[0], sks[2])
+	assert.True(t, errors.Is(err, dory.ErrParamsMismatch))
+
+	_, err = TryComputeThresholdParams(pps, ring, 6)
+	assert.EqualError(t, err, "threshold 6 is invalid for a ring of size 5")
+	_, err = TryComputeThresholdParams(pps, Ring{ring[0], nil}, 2)
+	assert.EqualError(t, err, "ring member 1 is missing")
+	_, err = TryComputeThresholdParams(dory.GeneratePublicParams(16), ring, 3)
+	assert.True(t, errors.Is(err, dory.ErrParamsMismatch))
+
+	// Malformed signatures are rejected before they are verified
+	for name, tamper := range map[string]func(ts *ThresholdSignature){
+		"malformed signature: signer 1: invalid tag commitment: missing G1 element": func(ts *ThresholdSignature) { ts.Signers[1].TagCommitment = nil },
+		"malformed signature: signer 0: invalid Y: missing G1 element":              func(ts *ThresholdSignature) { ts.Signers[0].Y = nil },
+		"malformed signature: signer 2: invalid Z: missing scalar":                  func(ts *ThresholdSignature) { ts.Signers[2].Z = nil },
+		"malformed signature: signer 2: invalid tag: missing G1 element":            func(ts *ThresholdSignature) { ts.Signers[2].TagValue = nil },
+		"malformed signature: invalid B: missing Gt element":                        func(ts *ThresholdSignature) { ts.B = nil },
+	} {
+		tampered = SignThreshold(tp, msg, prefix, ring, sks[4], sks[0], sks[2])
+		tamper(&tampered)
+		assert.EqualError(t, tampered.Verify(tp, msg, prefix), name)
+	}
+
+	tampered = SignThreshold(tp, msg, prefix, ring, sks[4], sks[0], sks[2])
+	tampered.DoryProof2.Step1Elements = tampered.DoryProof2.Step1Elements[1:]
+	assert.True(t, errors.Is(tampered.Verify(tp, msg, prefix), dory.ErrParamsMismatch))
+	assert.True(t, errors.Is(ts.Verify(ThresholdParams{threshold: 3}, msg, prefix), dory.ErrParamsMismatch))
+}
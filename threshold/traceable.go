@@ -0,0 +1,72 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"privacy-perserving-audit/tag"
+
+	math "github.com/IBM/mathlib"
+)
+
+// SignTraceable signs like Sign, but the signature also carries the trace tag of the message.
+// A signer that signs two distinct messages under the same prefix can then be traced with TraceSigner.
+func (key PrivateKey) SignTraceable(pp PublicParams, m []byte, prefix []byte, ring Ring) RingSignature {
+	return key.SignTraceableWithRand(rand.Reader, pp, m, prefix, ring)
+}
+
+// SignTraceableWithRand is SignTraceable with randomness read from rnd.
+func (key PrivateKey) SignTraceableWithRand(rnd io.Reader, pp PublicParams, m []byte, prefix []byte, ring Ring) RingSignature {
+	sk := math.Zr(key)
+	r, com := tag.CommitWithRand(rnd, &sk)
+
+	σ := key.RingProofWithRand(rnd, pp, ring, &r.R, com)
+
+	πt, trace := tag.NewTraceableProofWithRand(rnd, tagTranscript(σ.transcript, m), prefix, m, &sk, r)
+
+	σ.TagValue = tag.Tag(&sk, prefix)
+	σ.TagProof = πt
+	σ.Trace = &trace
+
+	return σ
+}
+
+// VerifyTraceable verifies the signature, and that it is traceable.
+func (rs RingSignature) VerifyTraceable(pp PublicParams, m, prefix []byte) error {
+	if rs.Trace == nil {
+		return fmt.Errorf("signature is not traceable")
+	}
+
+	return rs.Verify(pp, m, prefix)
+}
+
+// TraceSigner returns the index in the ring of the signer of two traceable signatures
+// on distinct messages under the same prefix. The signatures are assumed to be verified.
+func TraceSigner(ring Ring, prefix []byte, m1 []byte, σ1 RingSignature, m2 []byte, σ2 RingSignature) (int, error) {
+	if σ1.Trace == nil || σ2.Trace == nil {
+		return 0, fmt.Errorf("signature is not traceable")
+	}
+
+	if !Link(σ1, σ2) {
+		return 0, fmt.Errorf("signatures were made by distinct signers")
+	}
+
+	pk, err := tag.TracePublicKey(prefix, m1, σ1.Trace.Tag, m2, σ2.Trace.Tag)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range ring {
+		if ring[i].Equals(pk) {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("traced public key is not in the ring")
+}
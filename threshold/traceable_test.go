@@ -0,0 +1,66 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"encoding/asn1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceSigner(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 4)
+
+	m1, m2 := []byte("spend 1"), []byte("spend 2")
+
+	σ1 := sks[2].SignTraceable(pp, m1, prefix, ring)
+	σ2 := sks[2].SignTraceable(pp, m2, prefix, ring)
+	assert.NoError(t, σ1.VerifyTraceable(pp, m1, prefix))
+	assert.NoError(t, VerifyBatch(pp, m2, prefix, σ2))
+	assert.EqualError(t, σ1.VerifyTraceable(pp, m2, prefix), "tag proof invalid")
+
+	index, err := TraceSigner(ring, prefix, m1, σ1, m2, σ2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, index)
+
+	loaded, err := SignatureFromBytes(σ2.Bytes())
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.VerifyTraceable(pp, m2, prefix))
+	index, err = TraceSigner(ring, prefix, m1, σ1, m2, loaded)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, index)
+
+	// Traceable signatures are encoded as they were before accountable signatures were introduced
+	var ss SerializedSignature
+	_, err = asn1.Unmarshal(σ2.Bytes(), &ss)
+	assert.NoError(t, err)
+	type traceableSignature struct {
+		TagProof, TagCommitment, TagValue, DoryProof1, DoryProof2, B, Z, Y []byte
+		TraceTag, TraceCommitment                                          []byte
+	}
+	traceable, err := asn1.Marshal(traceableSignature{
+		ss.TagProof, ss.TagCommitment, ss.TagValue, ss.DoryProof1, ss.DoryProof2, ss.B, ss.Z, ss.Y,
+		ss.TraceTag, ss.TraceCommitment,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, traceable, σ2.Bytes())
+
+	// Stripping the trace invalidates the signature
+	loaded.Trace = nil
+	assert.EqualError(t, loaded.VerifyTraceable(pp, m2, prefix), "signature is not traceable")
+	assert.EqualError(t, loaded.Verify(pp, m2, prefix), "tag proof invalid")
+
+	_, err = TraceSigner(ring, prefix, m1, σ1, m2, sks[1].SignTraceable(pp, m2, prefix, ring))
+	assert.EqualError(t, err, "signatures were made by distinct signers")
+
+	_, err = TraceSigner(ring, prefix, m1, σ1, m1, sks[2].SignTraceable(pp, m1, prefix, ring))
+	assert.EqualError(t, err, "messages are identical")
+
+	_, err = TraceSigner(ring, prefix, m1, σ1, m2, sks[2].Sign(pp, m2, prefix, ring))
+	assert.EqualError(t, err, "signature is not traceable")
+}
@@ -0,0 +1,157 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"crypto/rand"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	. "privacy-perserving-audit/common"
+	. "privacy-perserving-audit/dory"
+	"privacy-perserving-audit/tag"
+
+	math "github.com/IBM/mathlib"
+)
+
+// UnlinkableSignature is a ring signature without a tag, hence signatures of the same signer cannot be linked.
+// Instead of a tag proof, it carries a proof of knowledge of the opening of its commitment.
+type UnlinkableSignature struct {
+	OpeningProof tag.OpeningProof
+	Commitment   *math.G1
+	DoryProof1   Proof
+	DoryProof2   Proof
+	B            *math.Gt
+	Z            *math.Zr
+	Y            *math.G1
+}
+
+// SignUnlinkable signs the message on behalf of the ring, without a tag.
+func (key PrivateKey) SignUnlinkable(pp PublicParams, m []byte, ring Ring) UnlinkableSignature {
+	return key.SignUnlinkableWithRand(rand.Reader, pp, m, ring)
+}
+
+// SignUnlinkableWithRand is SignUnlinkable with randomness read from rnd.
+func (key PrivateKey) SignUnlinkableWithRand(rnd io.Reader, pp PublicParams, m []byte, ring Ring) UnlinkableSignature {
+	sk := math.Zr(key)
+	r, com := tag.CommitWithRand(rnd, &sk)
+
+	σ := key.RingProofWithRand(rnd, pp, ring, &r.R, com)
+
+	return UnlinkableSignature{
+		OpeningProof: tag.NewOpeningProofWithRand(rnd, openingTranscript(σ.transcript, m), &sk, r),
+		Commitment:   com,
+		DoryProof1:   σ.DoryProof1,
+		DoryProof2:   σ.DoryProof2,
+		B:            σ.B,
+		Z:            σ.Z,
+		Y:            σ.Y,
+	}
+}
+
+func (us UnlinkableSignature) VerifyUnlinkable(pp PublicParams, m []byte) error {
+	if err := checkRingProof(pp, us.Commitment, us.B, us.Z, us.Y, us.DoryProof1, us.DoryProof2); err != nil {
+		return err
+	}
+	if err := us.OpeningProof.CheckShape(); err != nil {
+		return fmt.Errorf("malformed signature: invalid opening proof: %v", err)
+	}
+
+	ringProof, sumProof, t := RingSignature{
+		TagCommitment: us.Commitment,
+		DoryProof1:    us.DoryProof1,
+		DoryProof2:    us.DoryProof2,
+		B:             us.B,
+		Z:             us.Z,
+		Y:             us.Y,
+	}.prepareRingVerification(pp)
+
+	if err := ringProof.Verify(); err != nil {
+		return fmt.Errorf("first Dory proof invalid")
+	}
+
+	if err := sumProof.Verify(); err != nil {
+		return fmt.Errorf("second Dory proof invalid")
+	}
+
+	if err := us.OpeningProof.VerifyWithTranscript(openingTranscript(t, m), us.Commitment); err != nil {
+		return fmt.Errorf("opening proof invalid")
+	}
+
+	return nil
+}
+
+// openingTranscript is the counterpart of tagTranscript for unlinkable signatures.
+func openingTranscript(t *Transcript, m []byte) *Transcript {
+	ot := t.Fork("opening")
+	ot.AppendBytes("message", m)
+	return ot
+}
+
+type SerializedUnlinkableSignature struct {
+	OpeningProof []byte
+	Commitment   []byte
+	DoryProof1   []byte
+	DoryProof2   []byte
+	B            []byte
+	Z            []byte
+	Y            []byte
+}
+
+func (us UnlinkableSignature) Bytes() []byte {
+	bytes, err := asn1.Marshal(SerializedUnlinkableSignature{
+		OpeningProof: us.OpeningProof.Bytes(),
+		Commitment:   us.Commitment.Bytes(),
+		DoryProof1:   us.DoryProof1.Bytes(),
+		DoryProof2:   us.DoryProof2.Bytes(),
+		B:            us.B.Bytes(),
+		Z:            us.Z.Bytes(),
+		Y:            us.Y.Bytes(),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return bytes
+}
+
+func UnlinkableSignatureFromBytes(bytes []byte) (UnlinkableSignature, error) {
+	var ss SerializedUnlinkableSignature
+	rest, err := asn1.Unmarshal(bytes, &ss)
+	if err != nil {
+		return UnlinkableSignature{}, fmt.Errorf("failed unmarshaling signature: %v", err)
+	}
+	if len(rest) > 0 {
+		return UnlinkableSignature{}, fmt.Errorf("trailing bytes after signature")
+	}
+
+	var us UnlinkableSignature
+
+	if us.OpeningProof, err = tag.OpeningProofFromBytes(ss.OpeningProof); err != nil {
+		return UnlinkableSignature{}, fmt.Errorf("invalid opening proof: %v", err)
+	}
+	if us.Commitment, err = G1FromBytes(ss.Commitment); err != nil {
+		return UnlinkableSignature{}, fmt.Errorf("invalid commitment: %v", err)
+	}
+	if us.DoryProof1, err = ProofFromBytes(ss.DoryProof1); err != nil {
+		return UnlinkableSignature{}, fmt.Errorf("invalid first Dory proof: %v", err)
+	}
+	if us.DoryProof2, err = ProofFromBytes(ss.DoryProof2); err != nil {
+		return UnlinkableSignature{}, fmt.Errorf("invalid second Dory proof: %v", err)
+	}
+	if us.B, err = GtFromBytes(ss.B); err != nil {
+		return UnlinkableSignature{}, fmt.Errorf("invalid B: %v", err)
+	}
+	if us.Z, err = ZrFromBytes(ss.Z); err != nil {
+		return UnlinkableSignature{}, fmt.Errorf("invalid Z: %v", err)
+	}
+	if us.Y, err = G1FromBytes(ss.Y); err != nil {
+		return UnlinkableSignature{}, fmt.Errorf("invalid Y: %v", err)
+	}
+
+	return us, nil
+}
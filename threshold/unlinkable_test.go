@@ -0,0 +1,35 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignUnlinkable(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 3)
+
+	σ1 := sks[0].SignUnlinkable(pp, msg, ring)
+	σ2 := sks[0].SignUnlinkable(pp, msg, ring)
+	assert.NoError(t, σ1.VerifyUnlinkable(pp, msg))
+	assert.NoError(t, σ2.VerifyUnlinkable(pp, msg))
+	assert.False(t, σ1.Commitment.Equals(σ2.Commitment))
+	assert.EqualError(t, σ1.VerifyUnlinkable(pp, []byte("another message")), "opening proof invalid")
+
+	loaded, err := UnlinkableSignatureFromBytes(σ1.Bytes())
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.VerifyUnlinkable(pp, msg))
+
+	// The commitment is bound to the ring proof
+	loaded.Commitment = sks[1].SignUnlinkable(pp, msg, ring).Commitment
+	assert.EqualError(t, loaded.VerifyUnlinkable(pp, msg), "first Dory proof invalid")
+
+	_, err = UnlinkableSignatureFromBytes(append(σ1.Bytes(), 0))
+	assert.EqualError(t, err, "trailing bytes after signature")
+}
@@ -0,0 +1,206 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	gomath "math"
+	. "privacy-perserving-audit/common"
+	"privacy-perserving-audit/tag"
+
+	math "github.com/IBM/mathlib"
+)
+
+// WeightedRing is a ring whose members have voting weights.
+// The weight w of every member is folded into its key as pk + w U, where nobody knows the discrete logarithm of U.
+// The pre-processed parameters are computed over these keys, hence their digest commits to the weights.
+// A signature carries a commitment w U + s H to the weight of its signer, and its ring proof proves that
+// the commitment opens to the weight of some member of the ring, without revealing the weight nor the member.
+type WeightedRing struct {
+	Ring    Ring
+	Weights []uint64
+}
+
+// NewWeightedRing assigns the given weights to the members of the ring.
+func NewWeightedRing(ring Ring, weights []uint64) (WeightedRing, error) {
+	if len(ring) != len(weights) {
+		return WeightedRing{}, fmt.Errorf("ring of size %d has %d weights", len(ring), len(weights))
+	}
+
+	for i, w := range weights {
+		if w > gomath.MaxInt64 {
+			return WeightedRing{}, fmt.Errorf("weight %d of member %d is too large", w, i)
+		}
+	}
+
+	return WeightedRing{
+		Ring:    ring,
+		Weights: weights,
+	}, nil
+}
+
+// Keys returns the keys of the members with their weights folded in,
+// over which the pre-processed parameters of the weighted ring are computed.
+func (wr WeightedRing) Keys() Ring {
+	keys := make(Ring, len(wr.Ring))
+	for i, pk := range wr.Ring {
+		keys[i] = WeightedKey(pk, wr.Weights[i])
+	}
+	return keys
+}
+
+// WeightedKey returns pk + w U, the key of a member of weight w in a weighted ring.
+func WeightedKey(pk *math.G1, w uint64) *math.G1 {
+	key := pk.Copy()
+	key.Add(weightPoint(w))
+	return key
+}
+
+// weightGenerator returns U, which is hashed to the curve so that nobody knows its discrete logarithm.
+func weightGenerator() *math.G1 {
+	return curve.HashToG1([]byte("DualDory weight generator"))
+}
+
+// ringCommitment returns com + weightCommitment, which the ring proof of a signer is made for.
+// The weight commitment is nil unless the ring is weighted.
+func ringCommitment(com *math.G1, weightCommitment *math.G1) *math.G1 {
+	if weightCommitment == nil {
+		return com
+	}
+
+	res := com.Copy()
+	res.Add(weightCommitment)
+	return res
+}
+
+func weightPoint(w uint64) *math.G1 {
+	buff := make([]byte, 8)
+	binary.BigEndian.PutUint64(buff, w)
+	return weightGenerator().Mul(curve.NewZrFromBytes(buff))
+}
+
+// WeightOpening opens a weight commitment, or the sum of the weight commitments of several signatures,
+// as Weight U + S H.
+type WeightOpening struct {
+	Weight uint64
+	S      *math.Zr
+}
+
+// Add returns the opening of the sum of the commitments opened by wo and other.
+// It returns an error if the total weight overflows.
+func (wo WeightOpening) Add(other WeightOpening) (WeightOpening, error) {
+	if wo.S == nil {
+		return other, nil
+	}
+
+	if wo.Weight+other.Weight < wo.Weight {
+		return WeightOpening{}, fmt.Errorf("total weight overflows")
+	}
+
+	S := wo.S.Plus(other.S)
+	S.Mod(curve.GroupOrder)
+
+	return WeightOpening{
+		Weight: wo.Weight + other.Weight,
+		S:      S,
+	}, nil
+}
+
+// SignWeighted signs on behalf of a weighted ring. The signature carries a commitment to the weight of the signer,
+// whose opening is returned along with it. The signer hands the opening to whoever combines the signatures,
+// which adds up the openings of all signatures and publishes the total, see VerifyWeightedThreshold.
+// The public parameters are expected to be pre-processed over the keys of the weighted ring.
+func (key PrivateKey) SignWeighted(pp PublicParams, m []byte, prefix []byte, wr WeightedRing) (RingSignature, WeightOpening) {
+	return key.SignWeightedWithRand(rand.Reader, pp, m, prefix, wr)
+}
+
+// SignWeightedWithRand is SignWeighted with randomness read from rnd.
+func (key PrivateKey) SignWeightedWithRand(rnd io.Reader, pp PublicParams, m []byte, prefix []byte, wr WeightedRing) (RingSignature, WeightOpening) {
+	σ, opening, err := key.TrySignWeightedWithRand(rnd, pp, m, prefix, wr)
+	if err != nil {
+		panic(err)
+	}
+	return σ, opening
+}
+
+// TrySignWeightedWithRand is SignWeightedWithRand, but returns an error instead of panicking if the key is not in the ring,
+// the ring or the public parameters are malformed, or rnd fails.
+func (key PrivateKey) TrySignWeightedWithRand(rnd io.Reader, pp PublicParams, m []byte, prefix []byte, wr WeightedRing) (RingSignature, WeightOpening, error) {
+	sk := math.Zr(key)
+	_, pkIndex, err := key.findPK(wr.Ring)
+	if err != nil {
+		return RingSignature{}, WeightOpening{}, err
+	}
+
+	r, com, err := tag.TryCommitWithRand(rnd, &sk)
+	if err != nil {
+		return RingSignature{}, WeightOpening{}, err
+	}
+
+	opening := WeightOpening{
+		Weight: wr.Weights[pkIndex],
+	}
+	if opening.S, err = RandomZr(rnd); err != nil {
+		return RingSignature{}, WeightOpening{}, err
+	}
+
+	weightCommitment := weightPoint(opening.Weight)
+	weightCommitment.Add(H().Mul(opening.S))
+
+	// com + weightCommitment - (pk + w U) = (r + s) H
+	rs := r.R.Plus(opening.S)
+	rs.Mod(curve.GroupOrder)
+
+	σ, err := ringProof(rnd, pp, wr.Keys(), pkIndex, rs, com, weightCommitment)
+	if err != nil {
+		return RingSignature{}, WeightOpening{}, err
+	}
+
+	πt, err := tag.TryNewProofWithRand(rnd, tagTranscript(σ.transcript, m), prefix, &sk, r)
+	if err != nil {
+		return RingSignature{}, WeightOpening{}, err
+	}
+	t := tag.Tag(&sk, prefix)
+
+	σ.TagValue = t
+	σ.TagProof = πt
+
+	return σ, opening, nil
+}
+
+// VerifyWeightedThreshold verifies that the signatures were made by distinct members of a weighted ring,
+// whose weights add up to at least W. The total is the opening of the sum of the weight commitments of the signatures.
+// Only the total weight is revealed, not the weight of any signature nor which members signed.
+func VerifyWeightedThreshold(pp PublicParams, msg, prefix []byte, W uint64, total WeightOpening, signatures ...RingSignature) error {
+	if total.Weight < W {
+		return fmt.Errorf("signatures have a total weight of %d but %d is required", total.Weight, W)
+	}
+
+	if total.S == nil {
+		return fmt.Errorf("total weight opening is missing")
+	}
+
+	sum := curve.NewG1()
+	for i, σ := range signatures {
+		if σ.WeightCommitment == nil {
+			return fmt.Errorf("signature %d is not weighted", i)
+		}
+		sum.Add(σ.WeightCommitment)
+	}
+
+	opened := weightPoint(total.Weight)
+	opened.Add(H().Mul(total.S))
+
+	if !sum.Equals(opened) {
+		return fmt.Errorf("total weight does not open the weight commitments of the signatures")
+	}
+
+	return verifyThresholdSignatures(pp, msg, prefix, true, signatures...)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright IBM Corp All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package threshold
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	gomath "math"
+	mrand "math/rand"
+	"privacy-perserving-audit/common"
+	"privacy-perserving-audit/dory"
+	"privacy-perserving-audit/tag"
+	"testing"
+
+	math "github.com/IBM/mathlib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyWeightedThreshold(t *testing.T) {
+	var ring Ring
+	var sks []PrivateKey
+	for i := 0; i < 4; i++ {
+		pk, sk := KeyGen()
+		ring = append(ring, (*math.G1)(&pk))
+		sks = append(sks, sk)
+	}
+
+	_, err := NewWeightedRing(ring, []uint64{1, 2, 3})
+	assert.EqualError(t, err, "ring of size 4 has 3 weights")
+
+	wr, err := NewWeightedRing(ring, []uint64{1, 2, 3, 5})
+	assert.NoError(t, err)
+
+	pps := dory.GeneratePublicParams(4)
+	pp := PublicParams{
+		DoryParams:         pps,
+		PreProcessedParams: ComputePreProcessedParams(pps, wr.Keys()),
+	}
+
+	σ1, o1 := sks[1].SignWeighted(pp, msg, prefix, wr)
+	σ2, o2 := sks[2].SignWeighted(pp, msg, prefix, wr)
+
+	// The signatures reveal neither the weights nor the signers
+	assert.False(t, σ1.WeightCommitment.Equals(weightPoint(2)))
+	assert.False(t, σ2.WeightCommitment.Equals(weightPoint(3)))
+
+	total, err := o1.Add(o2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), total.Weight)
+
+	assert.NoError(t, VerifyWeightedThreshold(pp, msg, prefix, 5, total, σ1, σ2))
+	assert.EqualError(t, VerifyWeightedThreshold(pp, msg, prefix, 6, total, σ1, σ2), "signatures have a total weight of 5 but 6 is required")
+
+	// The total weight cannot be inflated
+	inflated := total
+	inflated.Weight = 6
+	assert.EqualError(t, VerifyWeightedThreshold(pp, msg, prefix, 6, inflated, σ1, σ2), "total weight does not open the weight commitments of the signatures")
+
+	twice, err := o2.Add(o2)
+	assert.NoError(t, err)
+	assert.EqualError(t, VerifyWeightedThreshold(pp, msg, prefix, 4, twice, σ2, σ2), "signature set was signed by 1 out of 2 distinct signers")
+
+	loaded, err := SignatureFromBytes(σ2.Bytes())
+	assert.NoError(t, err)
+	assert.True(t, σ2.WeightCommitment.Equals(loaded.WeightCommitment))
+	assert.NoError(t, VerifyWeightedThreshold(pp, msg, prefix, 3, o2, loaded))
+
+	// A weighted signature is only valid along with the opening of its weight
+	assert.EqualError(t, loaded.Verify(pp, msg, prefix), "malformed signature: unexpected weight commitment")
+
+	σ3, o3 := sks[2].SignWeightedWithRand(mrand.New(mrand.NewSource(1)), pp, msg, prefix, wr)
+	σ4, o4 := sks[2].SignWeightedWithRand(mrand.New(mrand.NewSource(1)), pp, msg, prefix, wr)
+	assert.Equal(t, σ3.Bytes(), σ4.Bytes())
+	assert.True(t, o3.S.Equals(o4.S))
+
+	// A signer cannot claim a weight other than its own
+	σ5, o5 := sks[2].SignWeighted(pp, msg, prefix, wr)
+	σ5.WeightCommitment.Add(weightGenerator().Mul(curve.NewZrFromInt(2)))
+	o5.Weight = 5
+	assert.EqualError(t, VerifyWeightedThreshold(pp, msg, prefix, 5, o5, σ5), "signature 0 is invalid: first Dory proof invalid")
+
+	// Nor can it sign without its weight
+	σ := sks[0].Sign(pp, msg, prefix, ring)
+	assert.EqualError(t, σ.Verify(pp, msg, prefix), "first Dory proof invalid")
+	assert.EqualError(t, VerifyWeightedThreshold(pp, msg, prefix, 1, o1, σ), "signature 0 is not weighted")
+
+	_, err = WeightOpening{Weight: gomath.MaxUint64, S: o1.S}.Add(o2)
+	assert.EqualError(t, err, "total weight overflows")
+
+	_, outsider := KeyGen()
+	_, _, err = outsider.TrySignWeightedWithRand(rand.Reader, pp, msg, prefix, wr)
+	assert.True(t, errors.Is(err, ErrNotInRing))
+
+	for _, n := range []int64{10, 100, 200} {
+		_, _, err = sks[0].TrySignWeightedWithRand(io.LimitReader(rand.Reader, n), pp, msg, prefix, wr)
+		assert.EqualError(t, err, "failed reading randomness: unexpected EOF")
+	}
+}
+
+func TestWeightCommitmentForgery(t *testing.T) {
+	ring, sks, pp := newTestRing(t, 4)
+
+	// An outsider folds pk - sk' g + t H into the ring statement as a weight commitment,
+	// so that com + WC - pk = (r + t) H for a member pk it does not hold the key of
+	_, outsider := KeyGen()
+	sk := math.Zr(outsider)
+	w, com := tag.Commit(&sk)
+
+	ts := curve.NewRandomZr(rand.Reader)
+	wc := ring[2].Copy()
+	wc.Sub(curve.GenG1.Mul(&sk))
+	wc.Add(common.H().Mul(ts))
+
+	σ, err := ringProof(rand.Reader, pp, ring, 2, w.R.Plus(ts), com, wc)
+	assert.NoError(t, err)
+	σ.TagValue = tag.Tag(&sk, prefix)
+	σ.TagProof = tag.NewProofWithTranscript(tagTranscript(σ.transcript, msg), prefix, &sk, w)
+
+	forged, err := SignatureFromBytes(σ.Bytes())
+	assert.NoError(t, err)
+
+	assert.EqualError(t, forged.Verify(pp, msg, prefix), "malformed signature: unexpected weight commitment")
+	assert.Error(t, VerifyBatch(pp, msg, prefix, forged))
+	assert.Error(t, VerifyThresholdSignatures(pp, msg, prefix, sks[0].Sign(pp, msg, prefix, ring), forged))
+
+	// Over a weighted ring, the weight commitment does not open to a weight
+	wr, err := NewWeightedRing(ring, []uint64{1, 1, 1, 1})
+	assert.NoError(t, err)
+	wpp := PublicParams{
+		DoryParams:         pp.DoryParams,
+		PreProcessedParams: ComputePreProcessedParams(pp.DoryParams, wr.Keys()),
+	}
+
+	wc = wr.Keys()[2].Copy()
+	wc.Sub(curve.GenG1.Mul(&sk))
+	wc.Add(common.H().Mul(ts))
+
+	σ, err = ringProof(rand.Reader, wpp, wr.Keys(), 2, w.R.Plus(ts), com, wc)
+	assert.NoError(t, err)
+	σ.TagValue = tag.Tag(&sk, prefix)
+	σ.TagProof = tag.NewProofWithTranscript(tagTranscript(σ.transcript, msg), prefix, &sk, w)
+
+	assert.EqualError(t, VerifyWeightedThreshold(wpp, msg, prefix, 1, WeightOpening{Weight: 1, S: ts}, σ),
+		"total weight does not open the weight commitments of the signatures")
+}